@@ -0,0 +1,255 @@
+// Command mockoidc is a minimal OpenID Connect provider for trying out and testing the identity provider
+// sign in locally. Any email can sign in, the groups typed on the login form end up in the groups claim.
+// It is not meant to run anywhere but on a developer machine.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyId = "mock-oidc-key"
+
+type authorization struct {
+	clientId      string
+	redirectUri   string
+	codeChallenge string
+	nonce         string
+	email         string
+	name          string
+	groups        []string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+type provider struct {
+	issuer       string
+	backchannel  string
+	clientId     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<html>
+<head><title>Mock OIDC sign in</title></head>
+<body>
+<h1>Mock OIDC sign in</h1>
+<form method="post">
+  {{range $name, $values := .Query}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+  <p><label>Email <input name="login_email" value="editor@ozinshe.local"></label></p>
+  <p><label>Name <input name="login_name" value="Editor"></label></p>
+  <p><label>Groups (comma separated) <input name="login_groups" value="ozinshe-editors"></label></p>
+  <p><label><input type="checkbox" name="login_email_verified" value="true" checked> Email verified</label></p>
+  <p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>`))
+
+func main() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(getEnv("MOCK_OIDC_ISSUER", "http://localhost:8082"), "/"),
+		backchannel:  strings.TrimSuffix(getEnv("MOCK_OIDC_BACKCHANNEL_URL", ""), "/"),
+		clientId:     getEnv("MOCK_OIDC_CLIENT_ID", "ozinshe"),
+		clientSecret: getEnv("MOCK_OIDC_CLIENT_SECRET", "ozinshe-secret"),
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+	// Server to server endpoints may have to be reached under another host, e.g. inside docker compose
+	if p.backchannel == "" {
+		p.backchannel = p.issuer
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("GET /authorize", p.handleLoginPage)
+	mux.HandleFunc("POST /authorize", p.handleLogin)
+	mux.HandleFunc("POST /token", p.handleToken)
+	mux.HandleFunc("GET /jwks", p.handleJwks)
+
+	addr := getEnv("MOCK_OIDC_ADDR", ":8082")
+	log.Printf("Mock OIDC provider %s listening on %s", p.issuer, addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (p *provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.backchannel + "/token",
+		"jwks_uri":                              p.backchannel + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *provider) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("client_id") != p.clientId {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(w, map[string]any{"Query": r.URL.Query()})
+}
+
+func (p *provider) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirectUri, err := url.Parse(r.PostForm.Get("redirect_uri"))
+	if err != nil || r.PostForm.Get("client_id") != p.clientId || r.PostForm.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	groups := make([]string, 0)
+	for _, group := range strings.Split(r.PostForm.Get("login_groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientId:      p.clientId,
+		redirectUri:   redirectUri.String(),
+		codeChallenge: r.PostForm.Get("code_challenge"),
+		nonce:         r.PostForm.Get("nonce"),
+		email:         r.PostForm.Get("login_email"),
+		name:          r.PostForm.Get("login_name"),
+		groups:        groups,
+		emailVerified: r.PostForm.Get("login_email_verified") == "true",
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	query := redirectUri.Query()
+	query.Set("code", code)
+	query.Set("state", r.PostForm.Get("state"))
+	redirectUri.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (p *provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId != p.clientId || clientSecret != p.clientSecret {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, found := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("grant_type") != "authorization_code" || !found || time.Now().After(auth.expiresAt) ||
+		auth.redirectUri != r.PostForm.Get("redirect_uri") ||
+		auth.codeChallenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	subject := sha256.Sum256([]byte(strings.ToLower(auth.email)))
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            hex.EncodeToString(subject[:16]),
+		"aud":            auth.clientId,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": auth.emailVerified,
+		"name":           auth.name,
+		"groups":         auth.groups,
+	})
+	token.Header["kid"] = keyId
+
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *provider) handleJwks(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyId,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	bytes := make([]byte, 24)
+	_, _ = rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
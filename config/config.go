@@ -5,8 +5,57 @@ import "time"
 var Config *MapConfig
 
 type MapConfig struct {
-	AppHost            string        `mapstructure:"APP_HOST"`
-	DbConnectionString string        `mapstructure:"DB_CONNECTION_STRING"`
-	JwtSecretKey       string        `mapstructure:"JWT_SECRET_KEY"`
-	JwtExpiresIn       time.Duration `mapstructure:"JWT_EXPIRE_DURATION"`
+	AppHost                        string        `mapstructure:"APP_HOST"`
+	DbConnectionString             string        `mapstructure:"DB_CONNECTION_STRING"`
+	JwtSecretKey                   string        `mapstructure:"JWT_SECRET_KEY"`
+	JwtAlgorithm                   string        `mapstructure:"JWT_ALGORITHM"`
+	JwtKeyRotationInterval         time.Duration `mapstructure:"JWT_KEY_ROTATION_INTERVAL"`
+	JwtKeyGracePeriod              time.Duration `mapstructure:"JWT_KEY_GRACE_PERIOD"`
+	JwtExpiresIn                   time.Duration `mapstructure:"JWT_EXPIRE_DURATION"`
+	ImagesSignedUrls               bool          `mapstructure:"IMAGES_SIGNED_URLS"`
+	ImagesSigningKey               string        `mapstructure:"IMAGES_SIGNING_KEY"`
+	ImagesUrlExpiresIn             time.Duration `mapstructure:"IMAGES_URL_EXPIRE_DURATION"`
+	ApiUrl                         string        `mapstructure:"API_URL"`
+	Mailer                         string        `mapstructure:"MAILER"`
+	MailerLogFile                  string        `mapstructure:"MAILER_LOG_FILE"`
+	MailFrom                       string        `mapstructure:"MAIL_FROM"`
+	SmtpHost                       string        `mapstructure:"SMTP_HOST"`
+	SmtpPort                       int           `mapstructure:"SMTP_PORT"`
+	SmtpUsername                   string        `mapstructure:"SMTP_USERNAME"`
+	SmtpPassword                   string        `mapstructure:"SMTP_PASSWORD"`
+	VerificationTtl                time.Duration `mapstructure:"VERIFICATION_TOKEN_EXPIRE_DURATION"`
+	PasswordResetUrl               string        `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetTtl               time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_EXPIRE_DURATION"`
+	LoginMaxFailures               int           `mapstructure:"LOGIN_MAX_FAILURES"`
+	LoginLockoutDuration           time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginBackoffBase               time.Duration `mapstructure:"LOGIN_BACKOFF_BASE"`
+	LoginBackoffMax                time.Duration `mapstructure:"LOGIN_BACKOFF_MAX"`
+	LoginFailureWindow             time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+	MailResendInterval             time.Duration `mapstructure:"MAIL_RESEND_INTERVAL"`
+	MailMaxPerIpHourly             int           `mapstructure:"MAIL_MAX_PER_IP_HOURLY"`
+	TrustedProxies                 []string      `mapstructure:"TRUSTED_PROXIES"`
+	OidcEnabled                    bool          `mapstructure:"OIDC_ENABLED"`
+	OidcIssuerUrl                  string        `mapstructure:"OIDC_ISSUER_URL"`
+	OidcDiscoveryUrl               string        `mapstructure:"OIDC_DISCOVERY_URL"`
+	OidcClientId                   string        `mapstructure:"OIDC_CLIENT_ID"`
+	OidcClientSecret               string        `mapstructure:"OIDC_CLIENT_SECRET"`
+	OidcRedirectUrl                string        `mapstructure:"OIDC_REDIRECT_URL"`
+	OidcScopes                     string        `mapstructure:"OIDC_SCOPES"`
+	OidcRolesClaim                 string        `mapstructure:"OIDC_ROLES_CLAIM"`
+	OidcAdminRoles                 string        `mapstructure:"OIDC_ADMIN_ROLES"`
+	OidcEditorRoles                string        `mapstructure:"OIDC_EDITOR_ROLES"`
+	OidcDemoteLocalUsers           bool          `mapstructure:"OIDC_DEMOTE_LOCAL_USERS"`
+	OidcPostLoginRedirectUrl       string        `mapstructure:"OIDC_POST_LOGIN_REDIRECT_URL"`
+	PasswordMinLength              int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordBreachedListFile       string        `mapstructure:"PASSWORD_BREACHED_LIST_FILE"`
+	PasswordHashAlgorithm          string        `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	PasswordBcryptCost             int           `mapstructure:"PASSWORD_BCRYPT_COST"`
+	PasswordArgon2Memory           int           `mapstructure:"PASSWORD_ARGON2_MEMORY"`
+	PasswordArgon2Iterations       int           `mapstructure:"PASSWORD_ARGON2_ITERATIONS"`
+	PasswordArgon2Parallelism      int           `mapstructure:"PASSWORD_ARGON2_PARALLELISM"`
+	TwoFactorIssuer                string        `mapstructure:"TWO_FACTOR_ISSUER"`
+	TwoFactorChallengeTtl          time.Duration `mapstructure:"TWO_FACTOR_CHALLENGE_EXPIRE_DURATION"`
+	RecommendationsRefreshInterval time.Duration `mapstructure:"RECOMMENDATIONS_REFRESH_INTERVAL"`
+	RecommendationsNeighbours      int           `mapstructure:"RECOMMENDATIONS_NEIGHBOURS"`
+	PopularityRefreshInterval      time.Duration `mapstructure:"POPULARITY_REFRESH_INTERVAL"`
 }
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ApiTokensHandlers struct {
+	apiTokensRepo *repositories.ApiTokensRepository
+}
+
+func NewApiTokensHandlers(apiTokensRepo *repositories.ApiTokensRepository) *ApiTokensHandlers {
+	return &ApiTokensHandlers{apiTokensRepo: apiTokensRepo}
+}
+
+type createApiTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type ApiTokenResponse struct {
+	Id         int        `json:"id"`
+	ProfileId  int        `json:"profileId"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type CreatedApiTokenResponse struct {
+	ApiTokenResponse
+	Token string `json:"token"`
+}
+
+// HandleFindAll godoc
+// @Summary      List API tokens
+// @Description  Active personal API tokens of the current user
+// @Tags auth
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} handlers.ApiTokenResponse "OK"
+// @Failure   	 403  {object} models.ApiError "Not available with an API token"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/tokens [get]
+// @Security Bearer
+func (h *ApiTokensHandlers) HandleFindAll(c *gin.Context) {
+	tokens, err := h.apiTokensRepo.FindAllActive(c, c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	response := make([]ApiTokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, mapApiTokenToResponse(token))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleCreate godoc
+// @Summary      Create an API token
+// @Description  The token is returned only once, send it as "Bearer oz_..." in the Authorization header.
+// @Description  It acts as the active profile, with the age restrictions of that profile.
+// @Description  Scopes: catalog:read, catalog:write, library:read, library:write, users:read, users:write
+// @Tags auth
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.createApiTokenRequest true "Name, scopes and optional expiry"
+// @Success      200  {object} handlers.CreatedApiTokenResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 403  {object} models.ApiError "Not available with an API token"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/tokens [post]
+// @Security Bearer
+func (h *ApiTokensHandlers) HandleCreate(c *gin.Context) {
+	var request createApiTokenRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Name is required"))
+		return
+	}
+	if len(request.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewApiError("At least one scope is required"))
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(models.ApiScopes, scope) {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Unknown scope "+scope))
+			return
+		}
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Expiry has to be in the future"))
+		return
+	}
+
+	secret, _, err := services.GenerateSecureToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	// The prefix tells API tokens apart from access tokens and makes leaked ones easy to spot
+	tokenString := models.ApiTokenPrefix + secret
+
+	slices.Sort(request.Scopes)
+	token := models.ApiToken{
+		UserId:    c.GetInt("userId"),
+		ProfileId: c.GetInt("profileId"),
+		Name:      request.Name,
+		TokenHash: services.HashSecureToken(tokenString),
+		Hint:      tokenString[len(tokenString)-4:],
+		Scopes:    slices.Compact(request.Scopes),
+		CreatedAt: time.Now(),
+		ExpiresAt: request.ExpiresAt,
+	}
+
+	token.Id, err = h.apiTokensRepo.Create(c, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "apiToken.create", "apiToken", token.Id, nil, mapApiTokenToResponse(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, CreatedApiTokenResponse{
+		ApiTokenResponse: mapApiTokenToResponse(token),
+		Token:            tokenString,
+	})
+}
+
+// HandleRevoke godoc
+// @Summary      Revoke an API token
+// @Tags auth
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Token id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid token id"
+// @Failure   	 403  {object} models.ApiError "Not available with an API token"
+// @Failure   	 404  {object} models.ApiError "Token not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/tokens/{id} [delete]
+// @Security Bearer
+func (h *ApiTokensHandlers) HandleRevoke(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid token id"))
+		return
+	}
+
+	revoked, err := h.apiTokensRepo.Revoke(c, c.GetInt("userId"), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, models.NewApiError("Token not found"))
+		return
+	}
+
+	err = recordAudit(c, "apiToken.revoke", "apiToken", id, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func mapApiTokenToResponse(token models.ApiToken) ApiTokenResponse {
+	return ApiTokenResponse{
+		Id:         token.Id,
+		ProfileId:  token.ProfileId,
+		Name:       token.Name,
+		Hint:       token.Hint,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
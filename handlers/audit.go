@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"ozinshe-final-project/models"
+)
+
+// recordAudit stores the audit event of a change which has just been made. Handlers call it as soon as
+// the change succeeds and fail the request when the event can't be stored, so no change goes unrecorded.
+// Before and after are snapshots of the entity, nil when there's nothing to show; they must never contain secrets.
+func recordAudit(c *gin.Context, action string, entityType string, entityId any, before any, after any) error {
+	event := models.AuditEvent{
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   fmt.Sprint(entityId),
+		Before:     auditSnapshot(before),
+		After:      auditSnapshot(after),
+	}
+
+	return recordAuditEvent(c, event)
+}
+
+// recordAuditAs is recordAudit for requests without a signed in user, e.g. sign up or password reset.
+func recordAuditAs(c *gin.Context, actorUserId int, action string, entityType string, entityId any, before any, after any) error {
+	event := models.AuditEvent{
+		ActorUserId: &actorUserId,
+		Action:      action,
+		EntityType:  entityType,
+		EntityId:    fmt.Sprint(entityId),
+		Before:      auditSnapshot(before),
+		After:       auditSnapshot(after),
+	}
+
+	return recordAuditEvent(c, event)
+}
+
+func recordAuditEvent(c *gin.Context, event models.AuditEvent) error {
+	recorder, ok := c.Value(models.AuditRecorderKey).(models.AuditRecorder)
+	if !ok {
+		return errors.New("audit log is not available")
+	}
+
+	err := recorder(event)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event %s: %w", event.Action, err)
+	}
+
+	return nil
+}
+
+func auditSnapshot(value any) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+
+	snapshot, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Failed to take an audit snapshot: %s", err)
+		return nil
+	}
+
+	return snapshot
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strconv"
+	"time"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+type AuditHandlers struct {
+	repo *repositories.AuditRepository
+}
+
+func NewAuditHandlers(repo *repositories.AuditRepository) *AuditHandlers {
+	return &AuditHandlers{repo: repo}
+}
+
+type AuditEventResponse struct {
+	Id              int64           `json:"id"`
+	ActorUserId     *int            `json:"actorUserId"`
+	ActorApiTokenId *int            `json:"actorApiTokenId"`
+	Action          string          `json:"action"`
+	EntityType      string          `json:"entityType"`
+	EntityId        string          `json:"entityId"`
+	Before          json.RawMessage `json:"before" swaggertype:"object"`
+	After           json.RawMessage `json:"after" swaggertype:"object"`
+	Ip              string          `json:"ip"`
+	CreatedAt       time.Time       `json:"createdAt"`
+}
+
+// HandleFindAll godoc
+// @Summary      Audit log
+// @Description  Changes made through the API, the newest first. from and to are RFC 3339 times, format=csv downloads the events as CSV
+// @Tags audit
+// @Accept       json
+// @Produce      json
+// @Produce      text/csv
+// @Param actorId query int false "User who made the change"
+// @Param entityType query string false "Entity type, e.g. movie or user"
+// @Param entityId query string false "Entity id"
+// @Param action query string false "Action, e.g. movie.delete"
+// @Param from query string false "Earliest time, inclusive"
+// @Param to query string false "Latest time, inclusive"
+// @Param limit query int false "Page size, 100 by default and 1000 at most"
+// @Param offset query int false "Number of events to skip"
+// @Param format query string false "json or csv"
+// @Success      200  {array} handlers.AuditEventResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid filters"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /audit [get]
+// @Security Bearer
+func (h *AuditHandlers) HandleFindAll(c *gin.Context) {
+	filters, err := parseAuditFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid format"))
+		return
+	}
+
+	events, err := h.repo.FindAll(c, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	if format == "csv" {
+		writeAuditCsv(c, events)
+		return
+	}
+
+	c.JSON(http.StatusOK, mapAuditEventsToResponse(events))
+}
+
+func parseAuditFilters(c *gin.Context) (models.AuditFilters, error) {
+	filters := models.AuditFilters{
+		EntityType: c.Query("entityType"),
+		EntityId:   c.Query("entityId"),
+		Action:     c.Query("action"),
+		Limit:      auditDefaultLimit,
+	}
+
+	if actorIdStr := c.Query("actorId"); actorIdStr != "" {
+		actorId, err := strconv.Atoi(actorIdStr)
+		if err != nil {
+			return filters, errors.New("Invalid actorId")
+		}
+		filters.ActorUserId = actorId
+	}
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return filters, errors.New("Invalid from, expected an RFC 3339 time")
+		}
+		filters.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return filters, errors.New("Invalid to, expected an RFC 3339 time")
+		}
+		filters.To = &to
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > auditMaxLimit {
+			return filters, errors.New("Invalid limit")
+		}
+		filters.Limit = limit
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return filters, errors.New("Invalid offset")
+		}
+		filters.Offset = offset
+	}
+
+	return filters, nil
+}
+
+func writeAuditCsv(c *gin.Context, events []models.AuditEvent) {
+	c.Header("Content-Disposition", `attachment; filename="audit.csv"`)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "createdAt", "actorUserId", "actorApiTokenId", "action", "entityType", "entityId", "before", "after", "ip"})
+	for _, event := range events {
+		_ = writer.Write([]string{
+			strconv.FormatInt(event.Id, 10),
+			event.CreatedAt.Format(time.RFC3339),
+			formatOptionalId(event.ActorUserId),
+			formatOptionalId(event.ActorApiToken),
+			event.Action,
+			event.EntityType,
+			event.EntityId,
+			string(event.Before),
+			string(event.After),
+			event.Ip,
+		})
+	}
+	writer.Flush()
+}
+
+func formatOptionalId(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+func mapAuditEventsToResponse(events []models.AuditEvent) []AuditEventResponse {
+	response := make([]AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		response = append(response, AuditEventResponse{
+			Id:              event.Id,
+			ActorUserId:     event.ActorUserId,
+			ActorApiTokenId: event.ActorApiToken,
+			Action:          event.Action,
+			EntityType:      event.EntityType,
+			EntityId:        event.EntityId,
+			Before:          event.Before,
+			After:           event.After,
+			Ip:              event.Ip,
+			CreatedAt:       event.CreatedAt,
+		})
+	}
+
+	return response
+}
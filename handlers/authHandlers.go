@@ -1,23 +1,61 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"ozinshe-final-project/config"
 	"ozinshe-final-project/models"
 	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
 	"strconv"
 	"time"
 )
 
 type AuthHandlers struct {
-	usersRepo *repositories.UsersRepository
+	usersRepo      *repositories.UsersRepository
+	userTokensRepo *repositories.UserTokensRepository
+	twoFactorRepo  *repositories.TwoFactorRepository
+	sessionsRepo   *repositories.SessionsRepository
+	identitiesRepo *repositories.UserIdentitiesRepository
+	jwtService     *services.JwtService
+	oidcService    *services.OidcService
+	mailer         services.Mailer
+	loginThrottle  *services.LoginThrottle
+	mailThrottle   *services.MailThrottle
 }
 
-func NewAuthHandlers(usersRepo *repositories.UsersRepository) *AuthHandlers {
-	return &AuthHandlers{usersRepo: usersRepo}
+func NewAuthHandlers(
+	usersRepo *repositories.UsersRepository,
+	userTokensRepo *repositories.UserTokensRepository,
+	twoFactorRepo *repositories.TwoFactorRepository,
+	sessionsRepo *repositories.SessionsRepository,
+	identitiesRepo *repositories.UserIdentitiesRepository,
+	jwtService *services.JwtService,
+	oidcService *services.OidcService,
+	mailer services.Mailer,
+	loginThrottle *services.LoginThrottle,
+	mailThrottle *services.MailThrottle,
+) *AuthHandlers {
+	return &AuthHandlers{
+		usersRepo:      usersRepo,
+		userTokensRepo: userTokensRepo,
+		twoFactorRepo:  twoFactorRepo,
+		sessionsRepo:   sessionsRepo,
+		identitiesRepo: identitiesRepo,
+		jwtService:     jwtService,
+		oidcService:    oidcService,
+		mailer:         mailer,
+		loginThrottle:  loginThrottle,
+		mailThrottle:   mailThrottle,
+	}
 }
 
 type signInRequest struct {
@@ -25,14 +63,44 @@ type signInRequest struct {
 	Password string `json:"password"`
 }
 
+type signInTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+type signUpRequest struct {
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
 // HandleSignIn godoc
 // @Tags auth
 // @Summary      Sign In
+// @Description  Users with two-factor authentication enabled get a challengeToken instead of a token and finish signing in with auth/signIn/2fa
 // @Accept       json
 // @Produce      json
 // @Param request body handlers.signInRequest true "Request body"
-// @Success      200  {object} object{token=string} "OK"
+// @Success      200  {object} object{token=string,challengeToken=string} "OK"
 // @Failure   	 401  {object} models.ApiError "Unauthorized"
+// @Failure   	 403  {object} models.ApiError "Email is not verified"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /auth/signIn [post]
 func (h *AuthHandlers) HandleSignIn(c *gin.Context) {
@@ -42,23 +110,108 @@ func (h *AuthHandlers) HandleSignIn(c *gin.Context) {
 		return
 	}
 
+	attempt, ok := reserveLoginAttempt(c, h.loginThrottle, request.Email)
+	if !ok {
+		return
+	}
+
 	user, err := h.usersRepo.FindByEmail(c, request.Email)
-	if err != nil {
+	matches, needsRehash := false, false
+	if err == nil && user.PasswordHash != "" {
+		matches, needsRehash = services.VerifyPassword(user.PasswordHash, request.Password)
+	} else {
+		// Unknown emails and users without a password take as long, the timing doesn't tell them apart
+		services.VerifyDummyPassword(request.Password)
+	}
+	if !matches {
 		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid credentials"))
 		return
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password))
+
+	err = h.loginThrottle.RegisterSuccess(c, attempt)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid credentials"))
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	claims := jwt.RegisteredClaims{
-		Subject:   strconv.Itoa(user.Id),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Config.JwtExpiresIn)),
+	// The password is only known at this moment, so hashes made with outdated settings are upgraded now
+	if needsRehash {
+		passwordHash, err := services.HashPassword(request.Password)
+		if err == nil {
+			err = h.usersRepo.SetPasswordHash(c, user.Id, passwordHash)
+		}
+		if err != nil {
+			log.Printf("Failed to rehash the password of user %d: %s", user.Id, err)
+		}
+	}
+
+	if !user.IsVerified {
+		c.JSON(http.StatusForbidden, models.NewApiError("Email is not verified"))
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Config.JwtSecretKey))
+
+	tokens, err := h.issueSignInTokens(c, user.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// HandleSignInTwoFactor godoc
+// @Tags auth
+// @Summary      Finish signing in with a second factor
+// @Description  Exchanges the challengeToken from auth/signIn and a code from the authenticator app, or a recovery code, for a token
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.signInTwoFactorRequest true "Request body"
+// @Success      200  {object} object{token=string} "OK"
+// @Failure   	 401  {object} models.ApiError "Invalid or expired challenge or code"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/signIn/2fa [post]
+func (h *AuthHandlers) HandleSignInTwoFactor(c *gin.Context) {
+	var request signInTwoFactorRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	claims, err := h.jwtService.ParseToken(c, request.ChallengeToken, services.TokenTypeTwoFactorChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid or expired challenge"))
+		return
+	}
+
+	user, err := h.usersRepo.FindById(c, claims.UserId())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid or expired challenge"))
+		return
+	}
+
+	attempt, ok := reserveLoginAttempt(c, h.loginThrottle, user.Email)
+	if !ok {
+		return
+	}
+
+	ok, err = verifySecondFactor(c, h.twoFactorRepo, user.Id, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid code"))
+		return
+	}
+
+	err = h.loginThrottle.RegisterSuccess(c, attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	tokenString, err := h.issueAccessToken(c, user.Id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -67,6 +220,640 @@ func (h *AuthHandlers) HandleSignIn(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
 
+// reserveLoginAttempt lets the request guess the secret of the account, the attempt counts as a failure
+// until it is registered as a success. Responds with 429 when the account or the client IP is blocked.
+func reserveLoginAttempt(c *gin.Context, throttle *services.LoginThrottle, account string) (services.LoginAttempt, bool) {
+	attempt, retryAfter, err := throttle.Reserve(c, account, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return services.LoginAttempt{}, false
+	}
+	if retryAfter > 0 {
+		respondTooManyRequests(c, retryAfter, "Too many failed attempts, try again later")
+		return services.LoginAttempt{}, false
+	}
+
+	return attempt, true
+}
+
+// reserveMail lets the request send an email to the address. Responds with 429 when the address
+// or the client IP has asked for too many emails, whether the address is registered or not.
+func reserveMail(c *gin.Context, throttle *services.MailThrottle, email string) bool {
+	retryAfter, err := throttle.Reserve(c, email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+	if retryAfter > 0 {
+		respondTooManyRequests(c, retryAfter, "Too many emails requested, try again later")
+		return false
+	}
+
+	return true
+}
+
+func respondTooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, models.NewApiError(message))
+}
+
+// HandleOidcLogin godoc
+// @Tags auth
+// @Summary      Sign in with the identity provider
+// @Description  Redirects the browser to the OpenID Connect provider, it comes back to auth/oidc/callback
+// @Success      302  "Redirect to the identity provider"
+// @Failure   	 404  {object} models.ApiError "OpenID Connect sign in is disabled"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/oidc/login [get]
+func (h *AuthHandlers) HandleOidcLogin(c *gin.Context) {
+	if !config.Config.OidcEnabled {
+		c.JSON(http.StatusNotFound, models.NewApiError("OpenID Connect sign in is disabled"))
+		return
+	}
+
+	authorizationUrl, err := h.oidcService.AuthorizationUrl(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.Redirect(http.StatusFound, authorizationUrl)
+}
+
+// HandleOidcCallback godoc
+// @Tags auth
+// @Summary      Identity provider callback
+// @Description  Signs the user in, creating or linking the account by the verified email, and redirects to OIDC_POST_LOGIN_REDIRECT_URL
+// @Description  with token (or challengeToken when two-factor authentication is enabled) or error in the url fragment
+// @Param code query string false "Authorization code"
+// @Param state query string false "State from auth/oidc/login"
+// @Param error query string false "Error reported by the identity provider"
+// @Success      302  "Redirect to the application"
+// @Failure   	 404  {object} models.ApiError "OpenID Connect sign in is disabled"
+// @Router       /auth/oidc/callback [get]
+func (h *AuthHandlers) HandleOidcCallback(c *gin.Context) {
+	if !config.Config.OidcEnabled {
+		c.JSON(http.StatusNotFound, models.NewApiError("OpenID Connect sign in is disabled"))
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.redirectAfterOidcLogin(c, url.Values{"error": {providerError}})
+		return
+	}
+
+	identity, err := h.oidcService.Exchange(c, c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Printf("OpenID Connect sign in failed: %s", err)
+		h.redirectAfterOidcLogin(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	user, err := h.findOrProvisionOidcUser(c, identity)
+	if errors.Is(err, errOidcEmailNotVerified) {
+		h.redirectAfterOidcLogin(c, url.Values{"error": {"email_not_verified"}})
+		return
+	}
+	if errors.Is(err, errOidcAccountNotVerified) {
+		h.redirectAfterOidcLogin(c, url.Values{"error": {"account_not_verified"}})
+		return
+	}
+	if err != nil {
+		log.Printf("OpenID Connect sign in failed for %s: %s", identity.Subject, err)
+		h.redirectAfterOidcLogin(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	tokens, err := h.issueSignInTokens(c, user.Id)
+	if err != nil {
+		log.Printf("OpenID Connect sign in failed for user %d: %s", user.Id, err)
+		h.redirectAfterOidcLogin(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	values := url.Values{}
+	for key, value := range tokens {
+		values.Set(key, fmt.Sprint(value))
+	}
+	h.redirectAfterOidcLogin(c, values)
+}
+
+var (
+	errOidcEmailNotVerified   = errors.New("email is not verified by the identity provider")
+	errOidcAccountNotVerified = errors.New("email of the local account is not verified")
+)
+
+// findOrProvisionOidcUser returns the user linked to the identity. Unknown identities are linked to the user
+// with the same email, or a new user is created, but only when the provider has verified the email. A local
+// user is only linked once they have confirmed the email themselves, otherwise anyone could put the email of
+// a provider account on their own user and take over its sign ins.
+// The role follows the roles granted by the provider when it sends them and they are mapped, but users
+// created outside the provider only gain roles this way unless OIDC_DEMOTE_LOCAL_USERS is enabled.
+func (h *AuthHandlers) findOrProvisionOidcUser(c *gin.Context, identity services.OidcIdentity) (models.User, error) {
+	var user models.User
+	link, err := h.identitiesRepo.Find(c, identity.Issuer, identity.Subject)
+	switch {
+	case err == nil:
+		user, err = h.usersRepo.FindById(c, link.UserId)
+		if err != nil {
+			return models.User{}, err
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		if identity.Email == "" || !identity.EmailVerified {
+			return models.User{}, errOidcEmailNotVerified
+		}
+
+		link = models.UserIdentity{
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+			Email:   identity.Email,
+		}
+
+		user, err = h.usersRepo.FindByEmail(c, identity.Email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			name := identity.Name
+			if name == "" {
+				name = identity.Email
+			}
+
+			// Without a password hash the user can only sign in through the provider until a password is reset
+			user = models.User{Name: name, Email: identity.Email, IsVerified: true, Role: models.RoleUser}
+			user.Id, err = h.usersRepo.Create(c, user)
+			link.Provisioned = true
+			if err == nil {
+				err = recordAuditAs(c, user.Id, "user.create", "user", user.Id, nil, MapUserToResponse(user))
+			}
+		} else if err == nil && !user.IsVerified {
+			// Changing the email drops the verification, so a verified email is the one its owner confirmed
+			return models.User{}, errOidcAccountNotVerified
+		}
+		if err != nil {
+			return models.User{}, err
+		}
+
+		link.UserId = user.Id
+		err = h.identitiesRepo.Create(c, link)
+		if err != nil {
+			return models.User{}, err
+		}
+	default:
+		return models.User{}, err
+	}
+
+	role, ok := services.MapOidcRole(identity)
+	canDemote := link.Provisioned || config.Config.OidcDemoteLocalUsers
+	if ok && user.Role != role && (canDemote || models.IsHigherRole(role, user.Role)) {
+		err = h.usersRepo.SetRole(c, user.Id, role)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		before := MapUserToResponse(user)
+		user.Role = role
+		// Told apart from roles set by admins, the actor is the user signing in
+		err = recordAuditAs(c, user.Id, "user.setRoleFromOidc", "user", user.Id, before, MapUserToResponse(user))
+		if err != nil {
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (h *AuthHandlers) redirectAfterOidcLogin(c *gin.Context, values url.Values) {
+	// The fragment is not sent to servers, so the token does not end up in access logs
+	c.Redirect(http.StatusFound, config.Config.OidcPostLoginRedirectUrl+"#"+values.Encode())
+}
+
+// issueSignInTokens returns the token for a user who proved their identity, or a challenge token
+// when a second factor is required as well.
+func (h *AuthHandlers) issueSignInTokens(c *gin.Context, userId int) (gin.H, error) {
+	isTwoFactorEnabled, err := h.twoFactorRepo.IsEnabled(c, userId)
+	if err != nil {
+		return nil, err
+	}
+	if isTwoFactorEnabled {
+		challengeToken, err := h.jwtService.IssueToken(userId, "", 0, services.TokenTypeTwoFactorChallenge, config.Config.TwoFactorChallengeTtl)
+		if err != nil {
+			return nil, err
+		}
+
+		return gin.H{"challengeToken": challengeToken}, nil
+	}
+
+	tokenString, err := h.issueAccessToken(c, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"token": tokenString}, nil
+}
+
+// issueAccessToken starts a new session for the device and returns the token bound to it.
+func (h *AuthHandlers) issueAccessToken(c *gin.Context, userId int) (string, error) {
+	now := time.Now()
+	session := models.Session{
+		Id:        uuid.NewString(),
+		UserId:    userId,
+		UserAgent: c.Request.UserAgent(),
+		Ip:        c.ClientIP(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.Config.JwtExpiresIn),
+	}
+	err := h.sessionsRepo.Create(c, session)
+	if err != nil {
+		return "", err
+	}
+	err = recordAuditAs(c, userId, "session.create", "session", session.Id, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return h.jwtService.IssueToken(userId, session.Id, 0, services.TokenTypeAccess, config.Config.JwtExpiresIn)
+}
+
+// HandleSignUp godoc
+// @Tags auth
+// @Summary      Sign Up
+// @Description  Creates an unverified user and sends a verification link to the email. When the email is
+// @Description  already registered its owner is notified instead, the response is the same so that registered
+// @Description  emails can not be guessed
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.signUpRequest true "Request body"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 429  {object} models.ApiError "Too many emails requested, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/signUp [post]
+func (h *AuthHandlers) HandleSignUp(c *gin.Context) {
+	var request signUpRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Email = services.NormalizeEmail(request.Email)
+	if request.Email == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Email is required"))
+		return
+	}
+
+	if request.Password != request.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Passwords miss match"))
+		return
+	}
+
+	err := services.ValidatePassword(request.Password, request.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Signing up with a registered email notifies its owner, so it is limited like the other emails
+	if !reserveMail(c, h.mailThrottle, request.Email) {
+		return
+	}
+
+	// Hashed either way, so that the response time doesn't tell whether the email is registered
+	passwordHash, err := services.HashPassword(request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash password"))
+		return
+	}
+
+	existing, err := h.usersRepo.FindByEmail(c, request.Email)
+	if err == nil {
+		// An owner who never confirmed the email gets a new link instead
+		if existing.IsVerified {
+			err = h.sendAlreadyRegisteredEmail(existing)
+		} else {
+			err = sendVerificationEmail(c, h.userTokensRepo, h.mailer, existing)
+		}
+		if err != nil {
+			log.Printf("Failed to notify user %d about a sign up with their email: %s", existing.Id, err)
+		}
+
+		c.Status(http.StatusOK)
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	user := models.User{
+		Name:         request.Name,
+		Email:        request.Email,
+		PasswordHash: passwordHash,
+		Role:         models.RoleUser,
+	}
+
+	id, err := h.usersRepo.Create(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	user.Id = id
+
+	err = sendVerificationEmail(c, h.userTokensRepo, h.mailer, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to send verification email"))
+		return
+	}
+
+	err = recordAuditAs(c, id, "user.signUp", "user", id, nil, MapUserToResponse(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// HandleResendVerification godoc
+// @Tags auth
+// @Summary      Resend verification email
+// @Description  Responds the same whether the email is registered or not, so that registered emails can not be guessed
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.resendVerificationRequest true "Request body"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 429  {object} models.ApiError "Too many emails requested, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/resendVerification [post]
+func (h *AuthHandlers) HandleResendVerification(c *gin.Context) {
+	var request resendVerificationRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Email = services.NormalizeEmail(request.Email)
+	if !reserveMail(c, h.mailThrottle, request.Email) {
+		return
+	}
+
+	// Done in the background so that neither the response time nor a failure tells whether the email exists
+	go func(email string) {
+		c := context.Background()
+		user, err := h.usersRepo.FindByEmail(c, email)
+		if err == nil && !user.IsVerified {
+			err = sendVerificationEmail(c, h.userTokensRepo, h.mailer, user)
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Failed to resend verification email: %s", err)
+		}
+	}(request.Email)
+
+	c.Status(http.StatusOK)
+}
+
+// HandleVerify godoc
+// @Tags auth
+// @Summary      Verify email
+// @Accept       json
+// @Produce      json
+// @Param token query string true "Token from the verification email"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid or expired token"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/verify [get]
+func (h *AuthHandlers) HandleVerify(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid or expired token"))
+		return
+	}
+
+	userId, err := h.userTokensRepo.Consume(c, models.UserTokenPurposeVerification, services.HashSecureToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid or expired token"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.usersRepo.SetVerified(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAuditAs(c, userId, "user.verify", "user", userId, gin.H{"isVerified": false}, gin.H{"isVerified": true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleForgotPassword godoc
+// @Tags auth
+// @Summary      Forgot password
+// @Description  Sends a password reset link to the email. Responds the same whether the email is registered or not,
+// @Description  so that registered emails can not be guessed
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.forgotPasswordRequest true "Request body"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 429  {object} models.ApiError "Too many emails requested, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/forgotPassword [post]
+func (h *AuthHandlers) HandleForgotPassword(c *gin.Context) {
+	var request forgotPasswordRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Email = services.NormalizeEmail(request.Email)
+	if !reserveMail(c, h.mailThrottle, request.Email) {
+		return
+	}
+
+	// Done in the background so that the response time doesn't tell whether the email exists
+	go func(email string) {
+		err := h.sendPasswordResetEmail(context.Background(), email)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Failed to send password reset email: %s", err)
+		}
+	}(request.Email)
+
+	c.Status(http.StatusOK)
+}
+
+// HandleResetPassword godoc
+// @Tags auth
+// @Summary      Reset password
+// @Description  Sets a new password using the token from the reset email and signs the user out everywhere
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.resetPasswordRequest true "Request body"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or expired token"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/resetPassword [post]
+func (h *AuthHandlers) HandleResetPassword(c *gin.Context) {
+	var request resetPasswordRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if request.Password != request.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Passwords miss match"))
+		return
+	}
+
+	tokenHash := services.HashSecureToken(request.Token)
+	userId, err := h.userTokensRepo.FindUserId(c, models.UserTokenPurposePasswordReset, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid or expired token"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	user, err := h.usersRepo.FindById(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// The token stays usable when the password is rejected by the policy
+	err = services.ValidatePassword(request.Password, user.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	passwordHash, err := services.HashPassword(request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash password"))
+		return
+	}
+
+	_, err = h.userTokensRepo.Consume(c, models.UserTokenPurposePasswordReset, tokenHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid or expired token"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Sessions are revoked first, so a failure can't leave the new password set while the old sessions still work
+	err = h.sessionsRepo.RevokeAll(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	user.PasswordHash = passwordHash
+	err = h.usersRepo.Update(c, userId, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Following the emailed link proves the ownership of the email as well
+	if !user.IsVerified {
+		err = h.usersRepo.SetVerified(c, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+	}
+
+	err = recordAuditAs(c, userId, "user.resetPassword", "user", userId, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *AuthHandlers) sendPasswordResetEmail(c context.Context, email string) error {
+	user, err := h.usersRepo.FindByEmail(c, email)
+	if err != nil {
+		return err
+	}
+
+	err = h.userTokensRepo.Invalidate(c, user.Id, models.UserTokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := services.GenerateSecureToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.userTokensRepo.Create(c, models.UserToken{
+		UserId:    user.Id,
+		Purpose:   models.UserTokenPurposePasswordReset,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(config.Config.PasswordResetTtl),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", config.Config.PasswordResetUrl, url.QueryEscape(token))
+	body := fmt.Sprintf("Hello, %s!\n\nSomeone asked to reset the password of your Ozinshe account. "+
+		"If it was you, open the link below to set a new password:\n%s\n\n"+
+		"The link is valid for %s and can be used once. If it wasn't you, just ignore this email.\n",
+		user.Name, link, config.Config.PasswordResetTtl)
+
+	return h.mailer.Send(user.Email, "Reset your Ozinshe password", body)
+}
+
+// sendVerificationEmail replaces previously sent verification links with a new one.
+func sendVerificationEmail(c context.Context, userTokensRepo *repositories.UserTokensRepository, mailer services.Mailer, user models.User) error {
+	err := userTokensRepo.Invalidate(c, user.Id, models.UserTokenPurposeVerification)
+	if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := services.GenerateSecureToken()
+	if err != nil {
+		return err
+	}
+
+	err = userTokensRepo.Create(c, models.UserToken{
+		UserId:    user.Id,
+		Purpose:   models.UserTokenPurposeVerification,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(config.Config.VerificationTtl),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/auth/verify?token=%s", config.Config.ApiUrl, url.QueryEscape(token))
+	body := fmt.Sprintf("Hello, %s!\n\nConfirm your email by opening the link below:\n%s\n\nThe link is valid for %s.\n", user.Name, link, config.Config.VerificationTtl)
+
+	return mailer.Send(user.Email, "Confirm your Ozinshe account", body)
+}
+
+// sendAlreadyRegisteredEmail tells the owner of the account that someone tried to sign up with their email.
+func (h *AuthHandlers) sendAlreadyRegisteredEmail(user models.User) error {
+	body := fmt.Sprintf("Hello, %s!\n\nSomeone tried to create an Ozinshe account with this email, but you already have one. "+
+		"If it was you, just sign in, or use \"Forgot password\" if you don't remember the password. "+
+		"If it wasn't you, just ignore this email.\n",
+		user.Name)
+
+	return h.mailer.Send(user.Email, "You already have an Ozinshe account", body)
+}
+
 // HandleGetUserInfo godoc
 // @Summary      Get user info
 // @Tags auth
@@ -91,12 +878,38 @@ func (h *AuthHandlers) HandleGetUserInfo(c *gin.Context) {
 
 // HandleSignOut godoc
 // @Summary      Sign Out
+// @Description  Revokes the current session, the token stops working
 // @Tags auth
 // @Accept       json
 // @Produce      json
 // @Success      200   "OK"
+// @Failure   	 500  {object} models.ApiError
 // @Router       /auth/signOut [post]
 // @Security Bearer
 func (h *AuthHandlers) HandleSignOut(c *gin.Context) {
+	_, err := h.sessionsRepo.Revoke(c, c.GetInt("userId"), c.GetString("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "session.revoke", "session", c.GetString("sessionId"), nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
+
+// HandleJwks godoc
+// @Summary      Public keys verifying tokens
+// @Description  JSON Web Key Set of the keys tokens are signed with, empty when tokens are signed with a shared secret
+// @Tags auth
+// @Produce      json
+// @Success      200  {object} services.Jwks "OK"
+// @Router       /.well-known/jwks.json [get]
+func (h *AuthHandlers) HandleJwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtService.Jwks())
+}
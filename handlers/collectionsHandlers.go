@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CollectionsHandlers struct {
+	collectionsRepo *repositories.CollectionsRepository
+	moviesRepo      *repositories.MoviesRepository
+	usersRepo       *repositories.UsersRepository
+	postersService  *services.PostersService
+}
+
+func NewCollectionsHandlers(
+	collectionsRepo *repositories.CollectionsRepository,
+	moviesRepo *repositories.MoviesRepository,
+	usersRepo *repositories.UsersRepository,
+	postersService *services.PostersService,
+) *CollectionsHandlers {
+	return &CollectionsHandlers{
+		collectionsRepo: collectionsRepo,
+		moviesRepo:      moviesRepo,
+		usersRepo:       usersRepo,
+		postersService:  postersService,
+	}
+}
+
+// HandleFindAll godoc
+// @Summary      Get collections
+// @Description  Published collections with the movies the profile can see. Editors get unpublished collections and every movie too
+// @Tags collections
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.Collection "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /collections [get]
+// @Security Bearer
+func (h *CollectionsHandlers) HandleFindAll(c *gin.Context) {
+	isEditor, err := h.isEditor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	var publishedAt *time.Time
+	if !isEditor {
+		now := time.Now()
+		publishedAt = &now
+	}
+
+	collections, err := h.collectionsRepo.FindAll(c, publishedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.fillMovies(c, collections, isEditor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	presentCollections(collections)
+	c.JSON(http.StatusOK, collections)
+}
+
+// HandleFindById godoc
+// @Summary      Find collection by id
+// @Description  Unpublished collections are found only by editors
+// @Tags collections
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Collection id"
+// @Success      200  {object} models.Collection "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid collection id"
+// @Failure   	 404  {object} models.ApiError "Collection not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /collections/{id} [get]
+// @Security Bearer
+func (h *CollectionsHandlers) HandleFindById(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	isEditor, err := h.isEditor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !isEditor && !collection.IsPublished(time.Now()) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Collection not found"))
+		return
+	}
+
+	collections := []models.Collection{collection}
+	err = h.fillMovies(c, collections, isEditor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	presentCollections(collections)
+	c.JSON(http.StatusOK, collections[0])
+}
+
+// HandleCreate godoc
+// @Summary      Create collection
+// @Tags collections
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param title formData string true "Title"
+// @Param description formData string false "Description"
+// @Param movieIds formData []int false "Movie ids in the order they are shown"
+// @Param position formData int false "Position of the shelf on the home screen, 0 by default"
+// @Param publishedFrom formData string false "Start of the publish window, RFC 3339, shown right away when omitted"
+// @Param publishedUntil formData string false "End of the publish window, RFC 3339, shown forever when omitted"
+// @Param cover formData file false "Cover image"
+// @Param coverHash formData string false "SHA-256 of an already uploaded cover, sent instead of the cover"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /collections [post]
+// @Security Bearer
+func (h *CollectionsHandlers) HandleCreate(c *gin.Context) {
+	_, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	collection, err := h.parseCollection(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	// The cover is optional
+	collection.CoverUrl, err = h.saveCover(c)
+	if err != nil && !errors.Is(err, http.ErrMissingFile) {
+		handleImageError(c, err, "Cover")
+		return
+	}
+
+	collection.CreatedAt = time.Now()
+	collection.UpdatedAt = collection.CreatedAt
+	collection.Id, err = h.collectionsRepo.Create(c, collection)
+	if err != nil {
+		h.releaseCover(c, collection.CoverUrl)
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "collection.create", "collection", collection.Id, nil, collection)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": collection.Id})
+}
+
+// HandleUpdate godoc
+// @Summary      Update collection
+// @Tags collections
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param id path int true "Collection id"
+// @Param title formData string true "Title"
+// @Param description formData string false "Description"
+// @Param movieIds formData []int false "Movie ids in the order they are shown"
+// @Param position formData int false "Position of the shelf on the home screen, 0 by default"
+// @Param publishedFrom formData string false "Start of the publish window, RFC 3339, shown right away when omitted"
+// @Param publishedUntil formData string false "End of the publish window, RFC 3339, shown forever when omitted"
+// @Param cover formData file false "Cover image, the current one is kept when omitted"
+// @Param coverHash formData string false "SHA-256 of an already uploaded cover, sent instead of the cover"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Collection not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /collections/{id} [put]
+// @Security Bearer
+func (h *CollectionsHandlers) HandleUpdate(c *gin.Context) {
+	existing, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	_, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	collection, err := h.parseCollection(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	collection.CoverUrl, err = h.saveCover(c)
+	if errors.Is(err, http.ErrMissingFile) {
+		collection.CoverUrl = existing.CoverUrl
+	} else if err != nil {
+		handleImageError(c, err, "Cover")
+		return
+	}
+
+	collection.Id = existing.Id
+	collection.CreatedAt = existing.CreatedAt
+	collection.UpdatedAt = time.Now()
+	err = h.collectionsRepo.Update(c, collection)
+	if err != nil {
+		if collection.CoverUrl != existing.CoverUrl {
+			h.releaseCover(c, collection.CoverUrl)
+		}
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	if collection.CoverUrl != existing.CoverUrl {
+		h.releaseCover(c, existing.CoverUrl)
+	}
+
+	err = recordAudit(c, "collection.update", "collection", collection.Id, existing, collection)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete collection
+// @Tags collections
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Collection id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid collection id"
+// @Failure   	 404  {object} models.ApiError "Collection not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /collections/{id} [delete]
+// @Security Bearer
+func (h *CollectionsHandlers) HandleDelete(c *gin.Context) {
+	collection, ok := h.findCollection(c)
+	if !ok {
+		return
+	}
+
+	err := h.collectionsRepo.Delete(c, collection.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	h.releaseCover(c, collection.CoverUrl)
+
+	err = recordAudit(c, "collection.delete", "collection", collection.Id, collection, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *CollectionsHandlers) findCollection(c *gin.Context) (models.Collection, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid collection id"))
+		return models.Collection{}, false
+	}
+
+	collection, err := h.collectionsRepo.FindById(c, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Collection not found"))
+		return models.Collection{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// parseCollection reads the form fields of the collection, leaving the cover to saveCover.
+func (h *CollectionsHandlers) parseCollection(c *gin.Context) (models.Collection, error) {
+	collection := models.Collection{
+		Title:       strings.TrimSpace(c.PostForm("title")),
+		Description: c.PostForm("description"),
+		MovieIds:    make([]int, 0),
+	}
+	if collection.Title == "" {
+		return collection, errors.New("Title is required")
+	}
+
+	if positionStr := c.PostForm("position"); positionStr != "" {
+		position, err := strconv.Atoi(positionStr)
+		if err != nil || position < 0 {
+			return collection, errors.New("Invalid position")
+		}
+		collection.Position = position
+	}
+
+	var err error
+	collection.PublishedFrom, err = parseOptionalTime(c.PostForm("publishedFrom"))
+	if err != nil {
+		return collection, errors.New("Invalid publishedFrom, expected an RFC 3339 time")
+	}
+	collection.PublishedUntil, err = parseOptionalTime(c.PostForm("publishedUntil"))
+	if err != nil {
+		return collection, errors.New("Invalid publishedUntil, expected an RFC 3339 time")
+	}
+	if collection.PublishedFrom != nil && collection.PublishedUntil != nil && !collection.PublishedUntil.After(*collection.PublishedFrom) {
+		return collection, errors.New("publishedUntil must be after publishedFrom")
+	}
+
+	movies, err := h.moviesRepo.FindAll(c, models.MovieFilters{}, nil)
+	if err != nil {
+		return collection, err
+	}
+	for _, idStr := range c.PostFormArray("movieIds") {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || !slices.ContainsFunc(movies, func(movie models.Movie) bool { return movie.Id == id }) {
+			return collection, errors.New("Invalid movie id " + idStr)
+		}
+		if !slices.Contains(collection.MovieIds, id) {
+			collection.MovieIds = append(collection.MovieIds, id)
+		}
+	}
+
+	return collection, nil
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (h *CollectionsHandlers) saveCover(c *gin.Context) (string, error) {
+	if hash := c.PostForm("coverHash"); hash != "" {
+		return h.postersService.SaveByHash(c, hash)
+	}
+
+	cover, err := c.FormFile("cover")
+	if err != nil {
+		return "", err
+	}
+
+	return h.postersService.Save(c, cover)
+}
+
+func (h *CollectionsHandlers) releaseCover(c *gin.Context, id string) {
+	if id != "" {
+		_ = h.postersService.Release(c, id)
+	}
+}
+
+// fillMovies puts the movies of the collections in place, in the order set by the editor.
+// Movies the profile can't see are left out, unless the collections are shown to an editor.
+func (h *CollectionsHandlers) fillMovies(c *gin.Context, collections []models.Collection, isEditor bool) error {
+	var profile *models.Profile
+	if !isEditor {
+		current := currentProfile(c)
+		profile = &current
+	}
+
+	movies, err := h.moviesRepo.FindAll(c, models.MovieFilters{}, profile)
+	if err != nil {
+		return err
+	}
+
+	for i := range collections {
+		collections[i].Movies = collectionMovies(collections[i], movies)
+	}
+
+	return nil
+}
+
+func (h *CollectionsHandlers) isEditor(c *gin.Context) (bool, error) {
+	user, err := h.usersRepo.FindById(c, c.GetInt("userId"))
+	if err != nil {
+		return false, err
+	}
+
+	return user.Role == models.RoleEditor || user.Role == models.RoleAdmin, nil
+}
+
+func collectionMovies(collection models.Collection, movies []models.Movie) []models.Movie {
+	byId := make(map[int]models.Movie, len(movies))
+	for _, movie := range movies {
+		byId[movie.Id] = movie
+	}
+
+	selected := make([]models.Movie, 0, len(collection.MovieIds))
+	for _, id := range collection.MovieIds {
+		if movie, exists := byId[id]; exists {
+			selected = append(selected, movie)
+		}
+	}
+
+	return selected
+}
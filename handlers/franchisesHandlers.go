@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"cmp"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type FranchisesHandlers struct {
+	franchisesRepo *repositories.FranchisesRepository
+	moviesRepo     *repositories.MoviesRepository
+}
+
+func NewFranchisesHandlers(franchisesRepo *repositories.FranchisesRepository, moviesRepo *repositories.MoviesRepository) *FranchisesHandlers {
+	return &FranchisesHandlers{franchisesRepo: franchisesRepo, moviesRepo: moviesRepo}
+}
+
+type franchiseRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Order is release or chronological
+	Order string `json:"order"`
+	// MovieIds follow the chronology of the story
+	MovieIds []int `json:"movieIds"`
+}
+
+// HandleFindAll godoc
+// @Summary      Get franchises
+// @Tags franchises
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.Franchise "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /franchises [get]
+// @Security Bearer
+func (h *FranchisesHandlers) HandleFindAll(c *gin.Context) {
+	franchises, err := h.franchisesRepo.FindAll(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, franchises)
+}
+
+// HandleFindById godoc
+// @Summary      Find franchise by id
+// @Description  Movies of the franchise the profile can see, with the watched progress of the profile through them
+// @Tags franchises
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Franchise id"
+// @Param order query string false "release or chronological, the order of the franchise by default"
+// @Success      200  {object} models.Franchise "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Franchise not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /franchises/{id} [get]
+// @Security Bearer
+func (h *FranchisesHandlers) HandleFindById(c *gin.Context) {
+	franchise, ok := h.findFranchise(c)
+	if !ok {
+		return
+	}
+
+	order := c.DefaultQuery("order", franchise.Order)
+	if !models.IsValidFranchiseOrder(order) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid order"))
+		return
+	}
+
+	profile := currentProfile(c)
+	entries, err := h.franchisesRepo.FindEntries(c, franchise.Id, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Only the movies the profile can see are listed
+	franchise.MovieIds = make([]int, 0, len(entries))
+	for _, entry := range entries {
+		franchise.MovieIds = append(franchise.MovieIds, entry.MovieId)
+	}
+
+	franchise.Entries = orderFranchiseEntries(entries, order)
+	for _, entry := range franchise.Entries {
+		if entry.IsWatched {
+			franchise.WatchedCount++
+		} else if franchise.NextMovieId == 0 {
+			franchise.NextMovieId = entry.MovieId
+		}
+	}
+
+	c.JSON(http.StatusOK, franchise)
+}
+
+// HandleCreate godoc
+// @Summary      Create franchise
+// @Tags franchises
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.franchiseRequest true "Franchise, movies in the chronology of the story"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /franchises [post]
+// @Security Bearer
+func (h *FranchisesHandlers) HandleCreate(c *gin.Context) {
+	franchise, ok := h.parseFranchise(c, 0)
+	if !ok {
+		return
+	}
+
+	id, err := h.franchisesRepo.Create(c, franchise)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	franchise.Id = id
+	err = recordAudit(c, "franchise.create", "franchise", id, nil, franchise)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// HandleUpdate godoc
+// @Summary      Update franchise
+// @Tags franchises
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Franchise id"
+// @Param request body handlers.franchiseRequest true "Franchise, movies in the chronology of the story"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Franchise not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /franchises/{id} [put]
+// @Security Bearer
+func (h *FranchisesHandlers) HandleUpdate(c *gin.Context) {
+	existing, ok := h.findFranchise(c)
+	if !ok {
+		return
+	}
+
+	franchise, ok := h.parseFranchise(c, existing.Id)
+	if !ok {
+		return
+	}
+
+	franchise.Id = existing.Id
+	err := h.franchisesRepo.Update(c, franchise)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "franchise.update", "franchise", franchise.Id, existing, franchise)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete franchise
+// @Description  The movies stay in the catalog
+// @Tags franchises
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Franchise id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Franchise not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /franchises/{id} [delete]
+// @Security Bearer
+func (h *FranchisesHandlers) HandleDelete(c *gin.Context) {
+	franchise, ok := h.findFranchise(c)
+	if !ok {
+		return
+	}
+
+	err := h.franchisesRepo.Delete(c, franchise.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "franchise.delete", "franchise", franchise.Id, franchise, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *FranchisesHandlers) findFranchise(c *gin.Context) (models.Franchise, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid franchise id"))
+		return models.Franchise{}, false
+	}
+
+	franchise, err := h.franchisesRepo.FindById(c, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Franchise not found"))
+		return models.Franchise{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Franchise{}, false
+	}
+
+	return franchise, true
+}
+
+// parseFranchise reads and validates the request, id is the franchise being updated or 0 for a new one.
+func (h *FranchisesHandlers) parseFranchise(c *gin.Context, id int) (models.Franchise, bool) {
+	var request franchiseRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return models.Franchise{}, false
+	}
+
+	franchise := models.Franchise{
+		Title:       strings.TrimSpace(request.Title),
+		Description: request.Description,
+		Order:       request.Order,
+		MovieIds:    make([]int, 0, len(request.MovieIds)),
+	}
+	if franchise.Title == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Title is required"))
+		return models.Franchise{}, false
+	}
+	if franchise.Order == "" {
+		franchise.Order = models.FranchiseOrderRelease
+	}
+	if !models.IsValidFranchiseOrder(franchise.Order) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid order"))
+		return models.Franchise{}, false
+	}
+
+	for _, movieId := range request.MovieIds {
+		if slices.Contains(franchise.MovieIds, movieId) {
+			continue
+		}
+
+		_, err := h.moviesRepo.FindById(c, movieId, nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id "+strconv.Itoa(movieId)))
+			return models.Franchise{}, false
+		}
+
+		other, err := h.franchisesRepo.FindByMovie(c, movieId)
+		if err == nil && other.Id != id {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Movie "+strconv.Itoa(movieId)+" already belongs to "+other.Title))
+			return models.Franchise{}, false
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return models.Franchise{}, false
+		}
+
+		franchise.MovieIds = append(franchise.MovieIds, movieId)
+	}
+
+	return franchise, true
+}
+
+// movieFranchise places the movie within its franchise as seen by the profile, nil when the movie is not part of any.
+func movieFranchise(c *gin.Context, repo *repositories.FranchisesRepository, movieId int, profile *models.Profile) (*models.MovieFranchise, error) {
+	franchise, err := repo.FindByMovie(c, movieId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := repo.FindEntries(c, franchise.Id, profile)
+	if err != nil {
+		return nil, err
+	}
+	entries = orderFranchiseEntries(entries, franchise.Order)
+
+	i := slices.IndexFunc(entries, func(entry models.FranchiseEntry) bool { return entry.MovieId == movieId })
+	if i < 0 {
+		return nil, nil
+	}
+
+	placement := &models.MovieFranchise{
+		Id:       franchise.Id,
+		Title:    franchise.Title,
+		Order:    franchise.Order,
+		Position: i + 1,
+		Count:    len(entries),
+	}
+	if i > 0 {
+		placement.Previous = &entries[i-1]
+	}
+	if i < len(entries)-1 {
+		placement.Next = &entries[i+1]
+	}
+
+	return placement, nil
+}
+
+// orderFranchiseEntries numbers the entries, which come in the chronology of the story, and sorts them
+// in the order. Movies released the same year keep their chronological order.
+func orderFranchiseEntries(entries []models.FranchiseEntry, order string) []models.FranchiseEntry {
+	for i := range entries {
+		entries[i].ChronologicalPosition = i + 1
+		entries[i].PosterUrl = services.SignImageId(entries[i].PosterUrl)
+	}
+
+	released := slices.Clone(entries)
+	slices.SortStableFunc(released, func(a, b models.FranchiseEntry) int {
+		return cmp.Compare(a.ReleaseYear, b.ReleaseYear)
+	})
+	for i := range released {
+		released[i].ReleasePosition = i + 1
+		entries[released[i].ChronologicalPosition-1].ReleasePosition = i + 1
+	}
+
+	if order == models.FranchiseOrderRelease {
+		return released
+	}
+
+	return entries
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"net/http"
 	"ozinshe-final-project/models"
 	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
 	"strconv"
+	"strings"
 )
 
 type GenreHandlers struct {
@@ -19,8 +23,10 @@ func NewGenreHandlers(repo *repositories.GenresRepository) *GenreHandlers {
 // HandleFindAll godoc
 // @Tags genres
 // @Summary      Get genres list
+// @Description  Genres in their display order, with tree=true only the top level genres are listed and the subgenres are nested in Children
 // @Accept       json
 // @Produce      json
+// @Param tree query bool false "Whether to return the genres as a tree"
 // @Success      200  {array} models.Genre "OK"
 // @Failure   	 400  {object} models.ApiError "Validation error"
 // @Failure   	 500  {object} models.ApiError
@@ -33,29 +39,39 @@ func (h *GenreHandlers) HandleFindAll(c *gin.Context) {
 		return
 	}
 
+	if tree, _ := strconv.ParseBool(c.Query("tree")); tree {
+		genres = buildGenreTree(genres, nil)
+	}
+
 	c.JSON(http.StatusOK, genres)
 }
 
 // HandleFindById godoc
-// @Summary      Find genre by id
+// @Summary      Find genre by id or slug
 // @Tags genres
 // @Accept       json
 // @Produce      json
-// @Param id path int true "Genre ID"
+// @Param id path string true "Genre id or slug"
 // @Success      200  {object} models.Genre "OK"
 // @Failure   	 400  {object} models.ApiError "Validation error"
+// @Failure   	 404  {object} models.ApiError "Genre not found"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /genres/{id} [get]
 // @Security Bearer
 func (h *GenreHandlers) HandleFindById(c *gin.Context) {
 	idStr := c.Param("id")
+
+	var genre models.Genre
 	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid genre ID"))
+	if err == nil {
+		genre, err = h.repo.FindById(c, id)
+	} else {
+		genre, err = h.repo.FindBySlug(c, idStr)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Genre not found"))
 		return
 	}
-
-	genre, err := h.repo.FindById(c, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
@@ -66,6 +82,10 @@ func (h *GenreHandlers) HandleFindById(c *gin.Context) {
 
 type createGenreRequest struct {
 	Title string `json:"title"`
+	// Slug is made from the title when empty
+	Slug     string `json:"slug"`
+	ParentId *int   `json:"parentId"`
+	Position int    `json:"position"`
 }
 
 // HandleCreate godoc
@@ -86,17 +106,44 @@ func (h *GenreHandlers) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	genre := models.Genre{Title: request.Title}
+	genre := models.Genre{
+		Title:    strings.TrimSpace(request.Title),
+		Slug:     request.Slug,
+		ParentId: request.ParentId,
+		Position: request.Position,
+	}
+	if genre.Slug == "" {
+		genre.Slug = services.Slugify(genre.Title)
+		// A title like «1917» would make a slug which looks like an id
+		if genre.Slug != "" && !services.IsValidSlug(genre.Slug) {
+			genre.Slug = "genre-" + genre.Slug
+		}
+	}
+	if !h.validateGenre(c, genre, 0) {
+		return
+	}
+
 	id, err := h.repo.Create(c, genre)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	genre.Id = id
+	err = recordAudit(c, "genre.create", "genre", id, nil, genre)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
 
 type updateGenreRequest struct {
 	Title string `json:"title"`
+	// Slug stays the same when empty
+	Slug     string `json:"slug"`
+	ParentId *int   `json:"parentId"`
+	Position int    `json:"position"`
 }
 
 // HandleUpdate godoc
@@ -125,23 +172,43 @@ func (h *GenreHandlers) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	_, err = h.repo.FindById(c, id)
+	existing, err := h.repo.FindById(c, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	genre := models.Genre{Title: request.Title}
+	genre := models.Genre{
+		Title:    strings.TrimSpace(request.Title),
+		Slug:     request.Slug,
+		ParentId: request.ParentId,
+		Position: request.Position,
+	}
+	if genre.Slug == "" {
+		genre.Slug = existing.Slug
+	}
+	if !h.validateGenre(c, genre, id) {
+		return
+	}
+
 	err = h.repo.Update(c, id, genre)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
+
+	genre.Id = id
+	err = recordAudit(c, "genre.update", "genre", id, existing, genre)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
 	c.Status(http.StatusOK)
 }
 
 // HandleDelete godoc
 // @Summary      Delete genre
+// @Description  Subgenres of the genre move up to its parent
 // @Tags genres
 // @Accept       json
 // @Produce      json
@@ -159,7 +226,7 @@ func (h *GenreHandlers) HandleDelete(c *gin.Context) {
 		return
 	}
 
-	_, err = h.repo.FindById(c, id)
+	genre, err := h.repo.FindById(c, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -170,5 +237,78 @@ func (h *GenreHandlers) HandleDelete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	err = recordAudit(c, "genre.delete", "genre", id, genre, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
 	c.Status(http.StatusOK)
 }
+
+// validateGenre checks the genre before it is saved, id is the genre being updated or 0 for a new one.
+func (h *GenreHandlers) validateGenre(c *gin.Context, genre models.Genre, id int) bool {
+	if genre.Title == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Title is required"))
+		return false
+	}
+	if !services.IsValidSlug(genre.Slug) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Slug must be lowercase latin letters and digits joined by hyphens, and not only digits"))
+		return false
+	}
+
+	existing, err := h.repo.FindBySlug(c, genre.Slug)
+	if err == nil && existing.Id != id {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Slug is already taken by "+existing.Title))
+		return false
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+
+	if genre.ParentId == nil {
+		return true
+	}
+
+	genres, err := h.repo.FindAll(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+
+	parents := make(map[int]*int, len(genres))
+	for _, g := range genres {
+		parents[g.Id] = g.ParentId
+	}
+	if _, ok := parents[*genre.ParentId]; !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid parent id"))
+		return false
+	}
+
+	// The genre can't become a subgenre of itself or of one of its subgenres
+	for parentId := genre.ParentId; parentId != nil; parentId = parents[*parentId] {
+		if *parentId == id {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Genre can't be a subgenre of itself"))
+			return false
+		}
+	}
+
+	return true
+}
+
+// buildGenreTree nests the genres under their parents, keeping the order of the list. It returns
+// the children of the parent, the top level genres when the parent is nil.
+func buildGenreTree(genres []models.Genre, parentId *int) []models.Genre {
+	children := make([]models.Genre, 0)
+	for _, genre := range genres {
+		if (parentId == nil && genre.ParentId != nil) || (parentId != nil && (genre.ParentId == nil || *genre.ParentId != *parentId)) {
+			continue
+		}
+
+		genre.Children = buildGenreTree(genres, &genre.Id)
+		children = append(children, genre)
+	}
+
+	return children
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"cmp"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"slices"
+	"time"
+)
+
+// Kinds of the home screen shelves
+const (
+	shelfTypeCollection  = "collection"
+	shelfTypeTrending    = "trending"
+	shelfTypeNewReleases = "newReleases"
+	shelfTypeGenre       = "genre"
+)
+
+// Shelves show up to homeShelfSize movies, genres with the most movies get a shelf each
+const (
+	homeShelfSize    = 20
+	homeGenreShelves = 5
+)
+
+type HomeHandlers struct {
+	collectionsRepo *repositories.CollectionsRepository
+	moviesRepo      *repositories.MoviesRepository
+	genresRepo      *repositories.GenresRepository
+}
+
+func NewHomeHandlers(
+	collectionsRepo *repositories.CollectionsRepository,
+	moviesRepo *repositories.MoviesRepository,
+	genresRepo *repositories.GenresRepository,
+) *HomeHandlers {
+	return &HomeHandlers{collectionsRepo: collectionsRepo, moviesRepo: moviesRepo, genresRepo: genresRepo}
+}
+
+// ShelfResponse is a row of the home screen: collection, trending, newReleases or genre.
+// Id refers to the collection or the genre the shelf is made of.
+type ShelfResponse struct {
+	Type        string         `json:"type"`
+	Id          int            `json:"id,omitempty"`
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	CoverUrl    string         `json:"coverUrl,omitempty"`
+	Movies      []models.Movie `json:"movies"`
+}
+
+// HandleGetHome godoc
+// @Summary      Home screen
+// @Description  Shelves of movies: trending this week, new releases and the genres with the most movies, with published collections put in at their positions. Empty shelves are left out
+// @Tags home
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} handlers.ShelfResponse "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /home [get]
+// @Security Bearer
+func (h *HomeHandlers) HandleGetHome(c *gin.Context) {
+	profile := currentProfile(c)
+	movies, err := h.moviesRepo.FindAll(c, models.MovieFilters{PopularityWindow: "week"}, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	presentMovies(movies)
+
+	genres, err := h.genresRepo.FindAll(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	now := time.Now()
+	collections, err := h.collectionsRepo.FindAll(c, &now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	shelves := generatedShelves(movies, genres)
+	// Collections come ordered by position, each one is put in at its position among the shelves
+	for _, collection := range collections {
+		shelf := ShelfResponse{
+			Type:        shelfTypeCollection,
+			Id:          collection.Id,
+			Title:       collection.Title,
+			Description: collection.Description,
+			CoverUrl:    services.SignImageId(collection.CoverUrl),
+			Movies:      collectionMovies(collection, movies),
+		}
+		shelves = slices.Insert(shelves, min(collection.Position, len(shelves)), shelf)
+	}
+
+	response := make([]ShelfResponse, 0, len(shelves))
+	for _, shelf := range shelves {
+		if len(shelf.Movies) > 0 {
+			shelf.Movies = shelf.Movies[:min(homeShelfSize, len(shelf.Movies))]
+			response = append(response, shelf)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func generatedShelves(movies []models.Movie, genres []models.Genre) []ShelfResponse {
+	trending := make([]models.Movie, 0)
+	for _, movie := range movies {
+		if movie.Popularity > 0 {
+			trending = append(trending, movie)
+		}
+	}
+	slices.SortStableFunc(trending, func(a, b models.Movie) int {
+		return cmp.Compare(b.Popularity, a.Popularity)
+	})
+
+	newReleases := slices.Clone(movies)
+	slices.SortStableFunc(newReleases, func(a, b models.Movie) int {
+		return cmp.Or(cmp.Compare(b.ReleaseYear, a.ReleaseYear), cmp.Compare(b.Id, a.Id))
+	})
+
+	shelves := []ShelfResponse{
+		{Type: shelfTypeTrending, Title: "Популярное на этой неделе", Movies: trending},
+		{Type: shelfTypeNewReleases, Title: "Новинки", Movies: newReleases},
+	}
+
+	genreShelves := make([]ShelfResponse, 0, len(genres))
+	for _, genre := range genres {
+		genreMovies := make([]models.Movie, 0)
+		for _, movie := range movies {
+			if slices.ContainsFunc(movie.Genres, func(g models.Genre) bool { return g.Id == genre.Id }) {
+				genreMovies = append(genreMovies, movie)
+			}
+		}
+		genreShelves = append(genreShelves, ShelfResponse{Type: shelfTypeGenre, Id: genre.Id, Title: genre.Title, Movies: genreMovies})
+	}
+	slices.SortStableFunc(genreShelves, func(a, b ShelfResponse) int {
+		return cmp.Compare(len(b.Movies), len(a.Movies))
+	})
+
+	return append(shelves, genreShelves[:min(homeGenreShelves, len(genreShelves))]...)
+}
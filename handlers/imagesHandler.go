@@ -1,28 +1,39 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"net/http"
 	"os"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/services"
 	"path/filepath"
+	"strings"
 )
 
 type ImageHandlers struct {
+	postersService *services.PostersService
 }
 
-func NewImageHandlers() *ImageHandlers {
-	return &ImageHandlers{}
+func NewImageHandlers(postersService *services.PostersService) *ImageHandlers {
+	return &ImageHandlers{postersService: postersService}
 }
 
 // HandleGetImageById godoc
 // @Summary      Download image
+// @Description  When signed urls are enabled the expires and signature parameters from the movie response are required
 // @Tags images
 // @Accept       json
 // @Produce      application/octet-stream
 // @Param imageId path int true "image id"
+// @Param expires query int false "Expiry of a signed url"
+// @Param signature query string false "Signature of a signed url"
 // @Success      200  {string} string "Image to download"
 // @Failure 400 {object} models.ApiError "Invalid image id"
+// @Failure 403 {object} models.ApiError "Invalid or expired signature"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /images/:imageId [get]
 func (h *ImageHandlers) HandleGetImageById(c *gin.Context) {
@@ -32,8 +43,13 @@ func (h *ImageHandlers) HandleGetImageById(c *gin.Context) {
 		return
 	}
 
+	if config.Config.ImagesSignedUrls && !services.VerifyImageSignature(imageId, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, models.NewApiError("Invalid or expired signature"))
+		return
+	}
+
 	fileName := filepath.Base(imageId)
-	byteFile, err := os.ReadFile(fmt.Sprintf("images/%s", imageId))
+	byteFile, err := os.ReadFile(services.GetImagePath(imageId))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -42,3 +58,46 @@ func (h *ImageHandlers) HandleGetImageById(c *gin.Context) {
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
 	c.Data(http.StatusOK, "application/octet-stream", byteFile)
 }
+
+// HandleFindByHash godoc
+// @Summary      Find image by content hash
+// @Description  Lets clients check whether a poster is already stored before uploading it
+// @Tags images
+// @Accept       json
+// @Produce      json
+// @Param hash path string true "SHA-256 of the image content, hex encoded"
+// @Success      200  {object} models.Image "OK"
+// @Failure   	 404  {object} models.ApiError "Image not found"
+// @Router       /images/hash/{hash} [get]
+// @Security Bearer
+func (h *ImageHandlers) HandleFindByHash(c *gin.Context) {
+	image, err := h.postersService.FindByHash(c, c.Param("hash"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("Image not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// handleImageError responds to a failed upload, subject names the image in the messages.
+func handleImageError(c *gin.Context, err error, subject string) {
+	if errors.Is(err, http.ErrMissingFile) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(fmt.Sprintf("%s is required", subject)))
+		return
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(fmt.Sprintf("Unknown %s hash", strings.ToLower(subject))))
+		return
+	}
+	if errors.Is(err, services.ErrUnsupportedImage) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(fmt.Sprintf("%s must be a JPEG, PNG or GIF image", subject)))
+		return
+	}
+	if errors.Is(err, services.ErrImageTooLarge) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(fmt.Sprintf("%s must be at most %d megapixels", subject, services.MaxImageMegapixels)))
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"strconv"
+)
+
+type MediaHandlers struct {
+	moviesRepo     *repositories.MoviesRepository
+	mediaRepo      *repositories.MediaRepository
+	postersService *services.PostersService
+}
+
+func NewMediaHandlers(
+	moviesRepo *repositories.MoviesRepository,
+	mediaRepo *repositories.MediaRepository,
+	postersService *services.PostersService,
+) *MediaHandlers {
+	return &MediaHandlers{moviesRepo: moviesRepo, mediaRepo: mediaRepo, postersService: postersService}
+}
+
+type updateMediaRequest struct {
+	Language  string `json:"language"`
+	Position  int    `json:"position"`
+	IsPrimary bool   `json:"isPrimary"`
+}
+
+// HandleFindAll godoc
+// @Summary      Get movie media
+// @Tags media
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param type query string false "Media type" Enums(poster, backdrop, still, trailer, teaser)
+// @Success      200  {array} models.MovieMedia "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid movie id"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/media [get]
+// @Security Bearer
+func (h *MediaHandlers) HandleFindAll(c *gin.Context) {
+	profile := currentProfile(c)
+	movieId, ok := h.findMovie(c, &profile)
+	if !ok {
+		return
+	}
+
+	media, err := h.mediaRepo.FindByMovie(c, movieId, c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	presentMedia(media)
+	c.JSON(http.StatusOK, media)
+}
+
+// HandleCreate godoc
+// @Summary      Add movie media
+// @Tags media
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param type formData string true "Media type" Enums(poster, backdrop, still, trailer, teaser)
+// @Param language formData string false "Language code"
+// @Param position formData int false "Position in the gallery"
+// @Param isPrimary formData bool false "Use the poster in movie lists"
+// @Param file formData file false "Image, required for posters, backdrops and stills"
+// @Param fileHash formData string false "SHA-256 of an already uploaded image, sent instead of the file"
+// @Param url formData string false "YouTube, Vimeo or direct MP4 link, required for trailers and teasers"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/media [post]
+// @Security Bearer
+func (h *MediaHandlers) HandleCreate(c *gin.Context) {
+	movieId, ok := h.findMovie(c, nil)
+	if !ok {
+		return
+	}
+
+	media := models.MovieMedia{
+		MovieId:  movieId,
+		Type:     c.PostForm("type"),
+		Language: c.PostForm("language"),
+	}
+
+	if positionStr := c.PostForm("position"); positionStr != "" {
+		position, err := strconv.Atoi(positionStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid position"))
+			return
+		}
+		media.Position = position
+	}
+
+	isPrimary := false
+	if isPrimaryStr := c.PostForm("isPrimary"); isPrimaryStr != "" {
+		value, err := strconv.ParseBool(isPrimaryStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid isPrimary value"))
+			return
+		}
+		isPrimary = value
+	}
+	if isPrimary && media.Type != models.MediaTypePoster {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Only a poster can be primary"))
+		return
+	}
+
+	switch {
+	case models.IsImageMediaType(media.Type):
+		id, err := h.saveImage(c)
+		if err != nil {
+			handleImageError(c, err, "Image")
+			return
+		}
+		media.Url = id
+	case models.IsVideoMediaType(media.Type):
+		trailer, err := services.ParseTrailerUrl(c.PostForm("url"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+			return
+		}
+		media.Url = trailer.Url
+		media.Provider = trailer.Provider
+		media.VideoId = trailer.VideoId
+	default:
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid media type"))
+		return
+	}
+
+	id, err := h.mediaRepo.Create(c, media)
+	if err != nil {
+		h.releaseImage(c, media)
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	media.Id = id
+
+	if isPrimary {
+		err = h.setPrimary(c, media)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+		media.IsPrimary = true
+	}
+
+	err = recordAudit(c, "media.create", "media", id, nil, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// HandleUpdate godoc
+// @Summary      Update movie media
+// @Tags media
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param mediaId path int true "Media id"
+// @Param request body handlers.updateMediaRequest true "Media data"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Media not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/media/{mediaId} [put]
+// @Security Bearer
+func (h *MediaHandlers) HandleUpdate(c *gin.Context) {
+	media, ok := h.findMedia(c)
+	if !ok {
+		return
+	}
+
+	var request updateMediaRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if request.IsPrimary && media.Type != models.MediaTypePoster {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Only a poster can be primary"))
+		return
+	}
+
+	before := media
+	media.Language = request.Language
+	media.Position = request.Position
+
+	err := h.mediaRepo.Update(c, media.Id, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	if request.IsPrimary && !media.IsPrimary {
+		err = h.setPrimary(c, media)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+		media.IsPrimary = true
+	}
+
+	err = recordAudit(c, "media.update", "media", media.Id, before, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete movie media
+// @Description  Deleting the primary poster keeps it as the movie poster
+// @Tags media
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param mediaId path int true "Media id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Media not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/media/{mediaId} [delete]
+// @Security Bearer
+func (h *MediaHandlers) HandleDelete(c *gin.Context) {
+	media, ok := h.findMedia(c)
+	if !ok {
+		return
+	}
+
+	err := h.mediaRepo.Delete(c, media.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "media.delete", "media", media.Id, media, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	h.releaseImage(c, media)
+	c.Status(http.StatusOK)
+}
+
+// findMovie makes sure the movie exists and the profile can see it, editors pass a nil profile to see every movie.
+func (h *MediaHandlers) findMovie(c *gin.Context, profile *models.Profile) (int, bool) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return 0, false
+	}
+
+	_, err = h.moviesRepo.FindById(c, movieId, profile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+		return 0, false
+	}
+
+	return movieId, true
+}
+
+func (h *MediaHandlers) findMedia(c *gin.Context) (models.MovieMedia, bool) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return models.MovieMedia{}, false
+	}
+
+	mediaId, err := strconv.Atoi(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid media id"))
+		return models.MovieMedia{}, false
+	}
+
+	media, err := h.mediaRepo.FindById(c, movieId, mediaId)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("Media not found"))
+		return models.MovieMedia{}, false
+	}
+
+	return media, true
+}
+
+func (h *MediaHandlers) saveImage(c *gin.Context) (string, error) {
+	if hash := c.PostForm("fileHash"); hash != "" {
+		return h.postersService.SaveByHash(c, hash)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return "", err
+	}
+
+	return h.postersService.Save(c, file)
+}
+
+func (h *MediaHandlers) releaseImage(c *gin.Context, media models.MovieMedia) {
+	if models.IsImageMediaType(media.Type) {
+		_ = h.postersService.Release(c, media.Url)
+	}
+}
+
+// setPrimary makes the poster the movie poster, which holds its own reference to the image.
+func (h *MediaHandlers) setPrimary(c *gin.Context, media models.MovieMedia) error {
+	err := h.postersService.Retain(c, media.Url)
+	if err != nil {
+		return err
+	}
+
+	previousPosterId, err := h.mediaRepo.SetPrimary(c, media)
+	if err != nil {
+		_ = h.postersService.Release(c, media.Url)
+		return err
+	}
+
+	return h.postersService.Release(c, previousPosterId)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"time"
+)
+
+// recordMovieEvent counts what the current profile did with the movie towards its popularity.
+// Popularity is not worth failing the request over, so errors are only logged.
+func recordMovieEvent(c *gin.Context, repo *repositories.MovieEventsRepository, movieId int, eventType string) {
+	event := models.MovieEvent{
+		MovieId:   movieId,
+		ProfileId: c.GetInt("profileId"),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+	}
+
+	err := repo.Create(c, event)
+	if err != nil {
+		log.Printf("Failed to record %s event of movie %d: %s", eventType, movieId, err)
+	}
+}
@@ -1,27 +1,49 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"net/http"
 	"ozinshe-final-project/models"
 	"ozinshe-final-project/repositories"
-	"path/filepath"
+	"ozinshe-final-project/services"
+	"slices"
 	"strconv"
 )
 
 type MoviesHandler struct {
-	moviesRepo *repositories.MoviesRepository
-	genresRepo *repositories.GenresRepository
+	moviesRepo     *repositories.MoviesRepository
+	genresRepo     *repositories.GenresRepository
+	tagsRepo       *repositories.TagsRepository
+	mediaRepo      *repositories.MediaRepository
+	eventsRepo     *repositories.MovieEventsRepository
+	franchisesRepo *repositories.FranchisesRepository
+	postersService *services.PostersService
 }
 
-func NewMoviesHandler(moviesRepo *repositories.MoviesRepository, genresRepo *repositories.GenresRepository) *MoviesHandler {
-	return &MoviesHandler{moviesRepo: moviesRepo, genresRepo: genresRepo}
+func NewMoviesHandler(
+	moviesRepo *repositories.MoviesRepository,
+	genresRepo *repositories.GenresRepository,
+	tagsRepo *repositories.TagsRepository,
+	mediaRepo *repositories.MediaRepository,
+	eventsRepo *repositories.MovieEventsRepository,
+	franchisesRepo *repositories.FranchisesRepository,
+	postersService *services.PostersService,
+) *MoviesHandler {
+	return &MoviesHandler{
+		moviesRepo:     moviesRepo,
+		genresRepo:     genresRepo,
+		tagsRepo:       tagsRepo,
+		mediaRepo:      mediaRepo,
+		eventsRepo:     eventsRepo,
+		franchisesRepo: franchisesRepo,
+		postersService: postersService,
+	}
 }
 
 // HandleFindById godoc
 // @Summary      Find by id
+// @Description  Along with the franchise of the movie and its neighbours in the franchise
 // @Tags movies
 // @Accept       json
 // @Produce      json
@@ -40,11 +62,22 @@ func (h *MoviesHandler) HandleFindById(c *gin.Context) {
 		return
 	}
 
-	movie, err := h.moviesRepo.FindById(c, id)
+	profile := currentProfile(c)
+	movie, err := h.moviesRepo.FindById(c, id, &profile)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
 		return
 	}
+
+	movie.Franchise, err = movieFranchise(c, h.franchisesRepo, movie.Id, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	recordMovieEvent(c, h.eventsRepo, movie.Id, models.MovieEventView)
+
+	presentMovie(&movie)
 	c.JSON(http.StatusOK, movie)
 }
 
@@ -54,27 +87,96 @@ func (h *MoviesHandler) HandleFindById(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param filters query models.MovieFilters true "Movie filters"
+// @Param window query string false "Popularity window for sort=popularity: day, week or month (default)"
+// @Param tags query []int false "Tag ids, only the movies with every tag are returned"
+// @Param subgenres query bool false "Whether genreids also match the subgenres of the genres"
 // @Success      200  {object} models.Movie "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /movies [get]
 // @Security Bearer
 func (h *MoviesHandler) HandleFindAll(c *gin.Context) {
 	filters := models.MovieFilters{
-		SearchTerm: c.Query("search"),
-		IsWatched:  c.Query("iswatched"),
-		GenreIds:   c.QueryArray("genreids"),
-		Sort:       c.Query("sort"),
+		SearchTerm:       c.Query("search"),
+		IsWatched:        c.Query("iswatched"),
+		GenreIds:         c.QueryArray("genreids"),
+		Sort:             c.Query("sort"),
+		PopularityWindow: c.Query("window"),
+	}
+	filters.IncludeSubgenres, _ = strconv.ParseBool(c.Query("subgenres"))
+	for _, idStr := range c.QueryArray("tags") {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid tag id"))
+			return
+		}
+		if !slices.Contains(filters.TagIds, id) {
+			filters.TagIds = append(filters.TagIds, id)
+		}
+	}
+	if filters.PopularityWindow != "" && !models.IsValidPopularityWindow(filters.PopularityWindow) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid window"))
+		return
 	}
 
-	movies, err := h.moviesRepo.FindAll(c, filters)
+	profile := currentProfile(c)
+	movies, err := h.moviesRepo.FindAll(c, filters, &profile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	presentMovies(movies)
 	c.JSON(http.StatusOK, movies)
 }
 
+// HandleFindTrending godoc
+// @Summary      Trending movies
+// @Description  Movies viewed, watched, rated and added to watchlists the most over the window, recent activity weighing more
+// @Tags movies
+// @Accept       json
+// @Produce      json
+// @Param window query string false "day, week (default) or month"
+// @Param limit query int false "Page size, 10 by default and 50 at most"
+// @Param offset query int false "Number of movies to skip"
+// @Success      200  {array} models.Movie "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/trending [get]
+// @Security Bearer
+func (h *MoviesHandler) HandleFindTrending(c *gin.Context) {
+	window := c.DefaultQuery("window", "week")
+	if !models.IsValidPopularityWindow(window) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid window"))
+		return
+	}
+
+	limit, offset, err := parsePage(c, movieListDefaultLimit, movieListMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	filters := models.MovieFilters{Sort: "-popularity", PopularityWindow: window}
+	profile := currentProfile(c)
+	movies, err := h.moviesRepo.FindAll(c, filters, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	trending := make([]models.Movie, 0, len(movies))
+	for _, movie := range movies {
+		if movie.Popularity > 0 {
+			trending = append(trending, movie)
+		}
+	}
+
+	trending = paginate(trending, limit, offset)
+	presentMovies(trending)
+	c.JSON(http.StatusOK, trending)
+}
+
 func (h *MoviesHandler) getGenresByIds(c *gin.Context, ids []int) ([]models.Genre, error) {
 	genres, err := h.genresRepo.FindAll(c)
 	if err != nil {
@@ -93,13 +195,80 @@ func (h *MoviesHandler) getGenresByIds(c *gin.Context, ids []int) ([]models.Genr
 	return selected, nil
 }
 
-func (h *MoviesHandler) transformFilename(poster string) string {
-	return fmt.Sprintf("%s%s", uuid.New(), filepath.Ext(poster))
+// parseTags reads the tags of the movie, the current ones are kept when they are omitted.
+func (h *MoviesHandler) parseTags(c *gin.Context, tags []models.Tag) ([]models.Tag, error) {
+	values, exists := c.GetPostFormArray("tagIds")
+	if !exists {
+		return tags, nil
+	}
+
+	all, err := h.tagsRepo.FindAll(c)
+	if err != nil {
+		return nil, err
+	}
+
+	tags = make([]models.Tag, 0, len(values))
+	for _, idStr := range values {
+		// An empty value clears the tags
+		if idStr == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(idStr)
+		i := slices.IndexFunc(all, func(tag models.Tag) bool { return tag.Id == id })
+		if err != nil || i < 0 {
+			return nil, errors.New("Invalid tag id " + idStr)
+		}
+		if !slices.Contains(tags, all[i]) {
+			tags = append(tags, all[i])
+		}
+	}
+
+	return tags, nil
+}
+
+// parseAgeRating reads the age rating and the advisories of the movie, the current values are kept when they are omitted.
+func parseAgeRating(c *gin.Context, ageRating int, advisories []string) (int, []string, error) {
+	if ageRatingStr := c.PostForm("ageRating"); ageRatingStr != "" {
+		value, err := strconv.Atoi(ageRatingStr)
+		if err != nil || !models.IsValidAgeRating(value) {
+			return 0, nil, errors.New("Invalid age rating")
+		}
+		ageRating = value
+	}
+
+	if values, exists := c.GetPostFormArray("advisories"); exists {
+		advisories = make([]string, 0, len(values))
+		for _, advisory := range values {
+			// An empty value clears the advisories
+			if advisory == "" {
+				continue
+			}
+			if !models.IsValidAdvisory(advisory) {
+				return 0, nil, errors.New("Invalid advisory " + advisory)
+			}
+			if !slices.Contains(advisories, advisory) {
+				advisories = append(advisories, advisory)
+			}
+		}
+	}
 
+	return ageRating, advisories, nil
 }
 
-func (h *MoviesHandler) getFilePath(filename string) string {
-	return fmt.Sprintf("images/%s", filename)
+// savePoster stores the uploaded poster or, when the client already knows the server has it,
+// refers to the existing image by its content hash.
+func (h *MoviesHandler) savePoster(c *gin.Context) (string, error) {
+	if hash := c.PostForm("posterHash"); hash != "" {
+		return h.postersService.SaveByHash(c, hash)
+	}
+
+	poster, err := c.FormFile("poster")
+	if err != nil {
+		return "", err
+	}
+
+	return h.postersService.Save(c, poster)
 }
 
 // HandleCreate godoc
@@ -111,9 +280,13 @@ func (h *MoviesHandler) getFilePath(filename string) string {
 // @Param description formData string true "Description"
 // @Param releaseYear formData int true "Year of release"
 // @Param director formData string true "Director"
-// @Param trailerUrl formData string true "Trailer URL"
+// @Param trailerUrl formData string true "Trailer URL: YouTube, Vimeo or a direct MP4 link"
 // @Param genreIds formData []int true "Genre ids"
-// @Param poster formData file true "Poster image"
+// @Param ageRating formData int false "Age rating: 0, 6, 12, 16 or 18, 18 when omitted"
+// @Param advisories formData []string false "Content advisories, e.g. violence or language"
+// @Param tagIds formData []int false "Tag ids"
+// @Param poster formData file false "Poster image"
+// @Param posterHash formData string false "SHA-256 of an already uploaded poster, sent instead of the poster"
 // @Success      200  {object} object{id=int} "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid data"
 // @Failure   	 500  {object} models.ApiError
@@ -132,9 +305,14 @@ func (h *MoviesHandler) HandleCreate(c *gin.Context) {
 	releaseYear, err := strconv.Atoi(releaseYearStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
 	}
 	director := c.PostForm("director")
-	trailerUrl := c.PostForm("trailerUrl")
+	trailer, err := services.ParseTrailerUrl(c.PostForm("trailerUrl"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
 
 	genresArray := c.PostFormArray("genreIds")
 	genreIds := make([]int, len(genresArray))
@@ -148,31 +326,55 @@ func (h *MoviesHandler) HandleCreate(c *gin.Context) {
 		genreIds[i] = id
 	}
 
+	// Movies are for adults until an editor says otherwise
+	ageRating, advisories, err := parseAgeRating(c, 18, []string{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
 	genres, err := h.getGenresByIds(c, genreIds)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	poster, _ := c.FormFile("poster")
-	filename := h.transformFilename(poster.Filename)
-	filePath := h.getFilePath(filename)
-	err = c.SaveUploadedFile(poster, filePath)
+	tags, err := h.parseTags(c, []models.Tag{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	filename, err := h.savePoster(c)
+	if err != nil {
+		handleImageError(c, err, "Poster")
+		return
 	}
 
 	movie := models.Movie{
-		Title:       title,
-		Description: description,
-		ReleaseYear: releaseYear,
-		Director:    director,
-		TrailerUrl:  trailerUrl,
-		PosterUrl:   filename,
-		Genres:      genres,
+		Title:           title,
+		Description:     description,
+		ReleaseYear:     releaseYear,
+		Director:        director,
+		AgeRating:       ageRating,
+		Advisories:      advisories,
+		TrailerUrl:      trailer.Url,
+		TrailerProvider: trailer.Provider,
+		TrailerVideoId:  trailer.VideoId,
+		PosterUrl:       filename,
+		Genres:          genres,
+		Tags:            tags,
 	}
 
 	id, err := h.moviesRepo.Create(c, movie)
+	if err != nil {
+		_ = h.postersService.Release(c, filename)
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	movie.Id = id
+	err = recordAudit(c, "movie.create", "movie", id, nil, movie)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
@@ -190,9 +392,13 @@ func (h *MoviesHandler) HandleCreate(c *gin.Context) {
 // @Param description formData string true "Description"
 // @Param releaseYear formData int true "Year of release"
 // @Param director formData string true "Director"
-// @Param trailerUrl formData string true "Trailer URL"
+// @Param trailerUrl formData string true "Trailer URL: YouTube, Vimeo or a direct MP4 link"
 // @Param genreIds formData []int true "Genre ids"
-// @Param poster formData file true "Poster image"
+// @Param ageRating formData int false "Age rating: 0, 6, 12, 16 or 18, kept when omitted"
+// @Param advisories formData []string false "Content advisories, kept when omitted, an empty value clears them"
+// @Param tagIds formData []int false "Tag ids, kept when omitted, an empty value clears them"
+// @Param poster formData file false "Poster image, the current one is kept when omitted"
+// @Param posterHash formData string false "SHA-256 of an already uploaded poster, sent instead of the poster"
 // @Success      200  {object} object{id=int} "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid data"
 // @Failure   	 500  {object} models.ApiError
@@ -206,7 +412,7 @@ func (h *MoviesHandler) HandleUpdate(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindById(c, id)
+	existing, err := h.moviesRepo.FindById(c, id, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -216,8 +422,16 @@ func (h *MoviesHandler) HandleUpdate(c *gin.Context) {
 	description := c.PostForm("description")
 	releaseYearStr := c.PostForm("releaseYear")
 	releaseYear, err := strconv.Atoi(releaseYearStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
 	director := c.PostForm("director")
-	trailerUrl := c.PostForm("trailerUrl")
+	trailer, err := services.ParseTrailerUrl(c.PostForm("trailerUrl"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
 
 	genresArray := c.PostFormArray("genreIds")
 	genreIds := make([]int, len(genresArray))
@@ -231,36 +445,78 @@ func (h *MoviesHandler) HandleUpdate(c *gin.Context) {
 		genreIds[i] = id
 	}
 
+	ageRating, advisories, err := parseAgeRating(c, existing.AgeRating, existing.Advisories)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
 	genres, err := h.getGenresByIds(c, genreIds)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	poster, _ := c.FormFile("poster")
-	filename := h.transformFilename(poster.Filename)
-	filePath := h.getFilePath(filename)
-	err = c.SaveUploadedFile(poster, filePath)
+	tags, err := h.parseTags(c, existing.Tags)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Poster is optional on update, the current one is kept when nothing is sent
+	filename, err := h.savePoster(c)
+	if errors.Is(err, http.ErrMissingFile) {
+		filename = existing.PosterUrl
+	} else if err != nil {
+		handleImageError(c, err, "Poster")
+		return
 	}
 
 	movie := models.Movie{
-		Id:          id,
-		Title:       title,
-		Description: description,
-		ReleaseYear: releaseYear,
-		Director:    director,
-		TrailerUrl:  trailerUrl,
-		PosterUrl:   filename,
-		Genres:      genres,
+		Id:              id,
+		Title:           title,
+		Description:     description,
+		ReleaseYear:     releaseYear,
+		Director:        director,
+		AgeRating:       ageRating,
+		Advisories:      advisories,
+		TrailerUrl:      trailer.Url,
+		TrailerProvider: trailer.Provider,
+		TrailerVideoId:  trailer.VideoId,
+		PosterUrl:       filename,
+		Genres:          genres,
+		Tags:            tags,
 	}
 
 	err = h.moviesRepo.Update(c, id, movie)
+	if err != nil {
+		if filename != existing.PosterUrl {
+			_ = h.postersService.Release(c, filename)
+		}
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "movie.update", "movie", id, existing, movie)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
+
+	if filename != existing.PosterUrl {
+		// A directly uploaded poster replaces the primary one from the gallery
+		err = h.mediaRepo.ClearPrimary(c, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+
+		err = h.postersService.Release(c, existing.PosterUrl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+	}
 	c.Status(http.StatusOK)
 }
 
@@ -283,17 +539,51 @@ func (h *MoviesHandler) HandleDelete(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindById(c, id)
+	movie, err := h.moviesRepo.FindById(c, id, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	media, err := h.mediaRepo.FindByMovie(c, id, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.mediaRepo.DeleteByMovie(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	err = h.moviesRepo.Delete(c, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
+
+	// Recorded right away, the movie is gone even if releasing the images fails below
+	err = recordAudit(c, "movie.delete", "movie", id, movie, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.postersService.Release(c, movie.PosterUrl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	for _, item := range media {
+		if models.IsImageMediaType(item.Type) {
+			err = h.postersService.Release(c, item.Url)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+				return
+			}
+		}
+	}
 	c.Status(http.StatusOK)
 }
 
@@ -324,18 +614,26 @@ func (h *MoviesHandler) HandleSetRating(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindById(c, id)
+	profile := currentProfile(c)
+	movie, err := h.moviesRepo.FindById(c, id, &profile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	err = h.moviesRepo.SetRating(c, id, rating)
+	err = h.moviesRepo.SetRating(c, profile.Id, id, rating)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	err = recordAudit(c, "movie.rate", "movie", id, gin.H{"profileId": profile.Id, "rating": movie.Rating}, gin.H{"profileId": profile.Id, "rating": rating})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	recordMovieEvent(c, h.eventsRepo, id, models.MovieEventRating)
+
 	c.Status(http.StatusOK)
 }
 
@@ -366,17 +664,27 @@ func (h *MoviesHandler) HandleSetWatched(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindById(c, id)
+	profile := currentProfile(c)
+	movie, err := h.moviesRepo.FindById(c, id, &profile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	err = h.moviesRepo.SetWatched(c, id, isWatched)
+	err = h.moviesRepo.SetWatched(c, profile.Id, id, isWatched)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	err = recordAudit(c, "movie.setWatched", "movie", id, gin.H{"profileId": profile.Id, "isWatched": movie.IsWatched}, gin.H{"profileId": profile.Id, "isWatched": isWatched})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if isWatched {
+		recordMovieEvent(c, h.eventsRepo, id, models.MovieEventWatch)
+	}
+
 	c.Status(http.StatusOK)
 }
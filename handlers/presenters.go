@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/services"
+)
+
+// presentMovie fills the fields of the movie which are computed when it is serialized.
+func presentMovie(movie *models.Movie) {
+	trailer := models.Trailer{Provider: movie.TrailerProvider, VideoId: movie.TrailerVideoId, Url: movie.TrailerUrl}
+	movie.TrailerEmbedUrl = services.TrailerEmbedUrl(trailer)
+	movie.TrailerThumbnailUrl = services.TrailerThumbnailUrl(trailer)
+	movie.PosterUrl = services.SignImageId(movie.PosterUrl)
+}
+
+func presentMovies(movies []models.Movie) {
+	for i := range movies {
+		presentMovie(&movies[i])
+	}
+}
+
+func presentCollections(collections []models.Collection) {
+	for i := range collections {
+		collections[i].CoverUrl = services.SignImageId(collections[i].CoverUrl)
+		presentMovies(collections[i].Movies)
+	}
+}
+
+func presentMedia(media []models.MovieMedia) {
+	for i := range media {
+		if models.IsVideoMediaType(media[i].Type) {
+			trailer := models.Trailer{Provider: media[i].Provider, VideoId: media[i].VideoId, Url: media[i].Url}
+			media[i].EmbedUrl = services.TrailerEmbedUrl(trailer)
+			media[i].ThumbnailUrl = services.TrailerThumbnailUrl(trailer)
+		} else {
+			media[i].Url = services.SignImageId(media[i].Url)
+		}
+	}
+}
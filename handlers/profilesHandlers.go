@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ProfilesHandlers struct {
+	profilesRepo  *repositories.ProfilesRepository
+	usersRepo     *repositories.UsersRepository
+	sessionsRepo  *repositories.SessionsRepository
+	jwtService    *services.JwtService
+	loginThrottle *services.LoginThrottle
+}
+
+func NewProfilesHandlers(
+	profilesRepo *repositories.ProfilesRepository,
+	usersRepo *repositories.UsersRepository,
+	sessionsRepo *repositories.SessionsRepository,
+	jwtService *services.JwtService,
+	loginThrottle *services.LoginThrottle,
+) *ProfilesHandlers {
+	return &ProfilesHandlers{
+		profilesRepo:  profilesRepo,
+		usersRepo:     usersRepo,
+		sessionsRepo:  sessionsRepo,
+		jwtService:    jwtService,
+		loginThrottle: loginThrottle,
+	}
+}
+
+type profileRequest struct {
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar"`
+	Language string `json:"language"`
+	IsKids   bool   `json:"isKids"`
+	// MaxAgeRating defaults to 18 for new profiles and is kept when omitted on update
+	MaxAgeRating *int `json:"maxAgeRating"`
+	// Pin is the parental PIN, required when the profile would see more than before
+	Pin string `json:"pin"`
+}
+
+type selectProfileRequest struct {
+	Pin string `json:"pin"`
+}
+
+type setParentalPinRequest struct {
+	Password string `json:"password"`
+	Pin      string `json:"pin"`
+}
+
+type ProfileResponse struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Avatar       string `json:"avatar"`
+	Language     string `json:"language"`
+	IsKids       bool   `json:"isKids"`
+	MaxAgeRating int    `json:"maxAgeRating"`
+	IsDefault    bool   `json:"isDefault"`
+	IsActive     bool   `json:"isActive"`
+}
+
+// HandleFindAll godoc
+// @Summary      List profiles
+// @Description  Viewer profiles of the account, the default one first
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} handlers.ProfileResponse "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /profiles [get]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleFindAll(c *gin.Context) {
+	profiles, err := h.profilesRepo.FindAll(c, c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	response := make([]ProfileResponse, 0, len(profiles))
+	for _, profile := range profiles {
+		response = append(response, mapProfileToResponse(c, profile))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleCreate godoc
+// @Summary      Create profile
+// @Description  Kids profiles only see movies rated 6+ or lower. The parental PIN is needed to create a profile which sees more than the current one
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.profileRequest true "Profile data"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or too many profiles"
+// @Failure   	 403  {object} models.ApiError "Not available in a kids profile or invalid parental PIN"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /profiles [post]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleCreate(c *gin.Context) {
+	if !canManageProfiles(c) {
+		return
+	}
+
+	var request profileRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Name is required"))
+		return
+	}
+
+	userId := c.GetInt("userId")
+	count, err := h.profilesRepo.Count(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if count >= models.MaxProfilesPerUser {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Too many profiles"))
+		return
+	}
+
+	profile := models.Profile{
+		UserId:       userId,
+		Name:         request.Name,
+		Avatar:       request.Avatar,
+		Language:     request.Language,
+		IsKids:       request.IsKids,
+		MaxAgeRating: 18,
+		CreatedAt:    time.Now(),
+	}
+	if request.MaxAgeRating != nil {
+		if !models.IsValidAgeRating(*request.MaxAgeRating) {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid age rating"))
+			return
+		}
+		profile.MaxAgeRating = *request.MaxAgeRating
+	}
+
+	// Otherwise a restricted profile could simply create an unrestricted one
+	if profile.AllowedAgeRating() > currentProfile(c).AllowedAgeRating() && !h.checkParentalPin(c, userId, request.Pin) {
+		return
+	}
+
+	profile.Id, err = h.profilesRepo.Create(c, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "profile.create", "profile", profile.Id, nil, mapProfileToResponse(c, profile))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": profile.Id})
+}
+
+// HandleUpdate godoc
+// @Summary      Update profile
+// @Description  The parental PIN is needed when the profile would see more than before
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Profile id"
+// @Param request body handlers.profileRequest true "Profile data"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Profile not found"
+// @Failure   	 403  {object} models.ApiError "Not available in a kids profile or invalid parental PIN"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /profiles/{id} [put]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleUpdate(c *gin.Context) {
+	if !canManageProfiles(c) {
+		return
+	}
+
+	profile, ok := h.findProfile(c)
+	if !ok {
+		return
+	}
+
+	var request profileRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Name is required"))
+		return
+	}
+
+	before := mapProfileToResponse(c, profile)
+	allowedAgeRating := profile.AllowedAgeRating()
+	profile.Name = request.Name
+	profile.Avatar = request.Avatar
+	profile.Language = request.Language
+	profile.IsKids = request.IsKids
+	if request.MaxAgeRating != nil {
+		if !models.IsValidAgeRating(*request.MaxAgeRating) {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid age rating"))
+			return
+		}
+		profile.MaxAgeRating = *request.MaxAgeRating
+	}
+
+	if profile.AllowedAgeRating() > allowedAgeRating && !h.checkParentalPin(c, profile.UserId, request.Pin) {
+		return
+	}
+
+	err := h.profilesRepo.Update(c, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "profile.update", "profile", profile.Id, before, mapProfileToResponse(c, profile))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete profile
+// @Description  Ratings and the watchlist of the profile are deleted too, the default profile can't be deleted
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Profile id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "The default profile can't be deleted"
+// @Failure   	 404  {object} models.ApiError "Profile not found"
+// @Failure   	 403  {object} models.ApiError "Not available in a kids profile"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /profiles/{id} [delete]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleDelete(c *gin.Context) {
+	if !canManageProfiles(c) {
+		return
+	}
+
+	profile, ok := h.findProfile(c)
+	if !ok {
+		return
+	}
+
+	if profile.IsDefault {
+		c.JSON(http.StatusBadRequest, models.NewApiError("The default profile can't be deleted"))
+		return
+	}
+
+	err := h.profilesRepo.Delete(c, profile.UserId, profile.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "profile.delete", "profile", profile.Id, mapProfileToResponse(c, profile), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleSelect godoc
+// @Summary      Select profile
+// @Description  Returns a token of the current session with the profile selected. Alternatively the profile can be sent in the X-Profile-Id header of every request
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Profile id"
+// @Param request body handlers.selectProfileRequest false "Parental PIN, required to switch to a profile which sees more than the current one"
+// @Success      200  {object} object{token=string} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid profile id"
+// @Failure   	 403  {object} models.ApiError "Invalid parental PIN"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 404  {object} models.ApiError "Profile not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /profiles/{id}/select [post]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleSelect(c *gin.Context) {
+	profile, ok := h.findProfile(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional, it's only needed for the PIN
+	var request selectProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if profile.AllowedAgeRating() > currentProfile(c).AllowedAgeRating() && !h.checkParentalPin(c, profile.UserId, request.Pin) {
+		return
+	}
+
+	session, err := h.sessionsRepo.FindActive(c, profile.UserId, c.GetString("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// The new token belongs to the same session, so it expires together with it
+	tokenString, err := h.jwtService.IssueToken(profile.UserId, session.Id, profile.Id, services.TokenTypeAccess, time.Until(session.ExpiresAt))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+}
+
+// HandleSetParentalPin godoc
+// @Summary      Set parental PIN
+// @Description  The PIN of four digits protects the age settings of profiles, an empty PIN turns parental controls off
+// @Tags profiles
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.setParentalPinRequest true "Account password and the new PIN"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid password or PIN"
+// @Failure   	 403  {object} models.ApiError "Not available in a kids profile"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/parentalPin [put]
+// @Security Bearer
+func (h *ProfilesHandlers) HandleSetParentalPin(c *gin.Context) {
+	if !canManageProfiles(c) {
+		return
+	}
+
+	var request setParentalPinRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if request.Pin != "" && !isValidParentalPin(request.Pin) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("PIN has to be 4 digits"))
+		return
+	}
+
+	userId := c.GetInt("userId")
+	user, err := h.usersRepo.FindById(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// The account password, not the old PIN, so that a forgotten PIN can be replaced
+	if matches, _ := services.VerifyPassword(user.PasswordHash, request.Password); !matches {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid password"))
+		return
+	}
+
+	pinHash := ""
+	if request.Pin != "" {
+		pinHash, err = services.HashPassword(request.Pin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash PIN"))
+			return
+		}
+	}
+
+	err = h.usersRepo.SetParentalPinHash(c, userId, pinHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "user.setParentalPin", "user", userId, nil, gin.H{"isEnabled": pinHash != ""})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// checkParentalPin lets the request through when the user has no parental PIN or the PIN is correct.
+// Guesses are throttled like passwords.
+func (h *ProfilesHandlers) checkParentalPin(c *gin.Context, userId int, pin string) bool {
+	pinHash, err := h.usersRepo.FindParentalPinHash(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+	if pinHash == "" {
+		return true
+	}
+
+	attempt, ok := reserveLoginAttempt(c, h.loginThrottle, services.ParentalPinAccount(userId))
+	if !ok {
+		return false
+	}
+
+	if matches, _ := services.VerifyPassword(pinHash, pin); !matches {
+		c.JSON(http.StatusForbidden, models.NewApiError("Invalid parental PIN"))
+		return false
+	}
+
+	err = h.loginThrottle.RegisterSuccess(c, attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+
+	return true
+}
+
+func isValidParentalPin(pin string) bool {
+	if len(pin) != 4 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *ProfilesHandlers) findProfile(c *gin.Context) (models.Profile, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid profile id"))
+		return models.Profile{}, false
+	}
+
+	profile, err := h.profilesRepo.FindById(c, c.GetInt("userId"), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Profile not found"))
+		return models.Profile{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Profile{}, false
+	}
+
+	return profile, true
+}
+
+// canManageProfiles keeps kids from turning their profile into a grown-up one.
+func canManageProfiles(c *gin.Context) bool {
+	if currentProfile(c).IsKids {
+		c.JSON(http.StatusForbidden, models.NewApiError("Not available in a kids profile"))
+		return false
+	}
+
+	return true
+}
+
+// currentProfile returns the active profile resolved by ProfileMiddleware.
+func currentProfile(c *gin.Context) models.Profile {
+	profile, _ := c.MustGet("profile").(models.Profile)
+	return profile
+}
+
+func mapProfileToResponse(c *gin.Context, profile models.Profile) ProfileResponse {
+	return ProfileResponse{
+		Id:           profile.Id,
+		Name:         profile.Name,
+		Avatar:       profile.Avatar,
+		Language:     profile.Language,
+		IsKids:       profile.IsKids,
+		MaxAgeRating: profile.MaxAgeRating,
+		IsDefault:    profile.IsDefault,
+		IsActive:     profile.Id == c.GetInt("profileId"),
+	}
+}
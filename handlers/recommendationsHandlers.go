@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"strconv"
+)
+
+// Page sizes of the ranked movie lists
+const (
+	movieListDefaultLimit = 10
+	movieListMaxLimit     = 50
+)
+
+type RecommendationsHandlers struct {
+	moviesRepo     *repositories.MoviesRepository
+	neighboursRepo *repositories.MovieNeighboursRepository
+}
+
+func NewRecommendationsHandlers(
+	moviesRepo *repositories.MoviesRepository,
+	neighboursRepo *repositories.MovieNeighboursRepository,
+) *RecommendationsHandlers {
+	return &RecommendationsHandlers{moviesRepo: moviesRepo, neighboursRepo: neighboursRepo}
+}
+
+// HandleFindSimilar godoc
+// @Summary      Similar movies
+// @Description  Movies sharing genres, the director, the release era and description keywords with the movie, the most similar first
+// @Tags recommendations
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param limit query int false "Page size, 10 by default and 50 at most"
+// @Param offset query int false "Number of movies to skip"
+// @Success      200  {array} models.Movie "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/similar [get]
+// @Security Bearer
+func (h *RecommendationsHandlers) HandleFindSimilar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid Movie Id"))
+		return
+	}
+
+	limit, offset, err := parsePage(c, movieListDefaultLimit, movieListMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	profile := currentProfile(c)
+	movie, err := h.moviesRepo.FindById(c, id, &profile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+
+	candidates, err := h.moviesRepo.FindAll(c, models.MovieFilters{}, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	movies := paginate(services.SimilarMovies(movie, candidates), limit, offset)
+	presentMovies(movies)
+	c.JSON(http.StatusOK, movies)
+}
+
+// HandleFindAlsoLiked godoc
+// @Summary      People who liked the movie also liked
+// @Description  Movies rated alike by the same profiles, recomputed in the background. Until the movie has enough ratings, similar movies are returned instead
+// @Tags recommendations
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param limit query int false "Page size, 10 by default and 50 at most"
+// @Param offset query int false "Number of movies to skip"
+// @Success      200  {array} models.Movie "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/alsoLiked [get]
+// @Security Bearer
+func (h *RecommendationsHandlers) HandleFindAlsoLiked(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid Movie Id"))
+		return
+	}
+
+	limit, offset, err := parsePage(c, movieListDefaultLimit, movieListMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	profile := currentProfile(c)
+	movie, err := h.moviesRepo.FindById(c, id, &profile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+
+	candidates, err := h.moviesRepo.FindAll(c, models.MovieFilters{}, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	neighbours, err := h.neighboursRepo.FindByMovies(c, []int{movie.Id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	alsoLiked := services.AlsoLikedMovies(movie, candidates, neighbours)
+	if len(alsoLiked) == 0 {
+		alsoLiked = services.SimilarMovies(movie, candidates)
+	}
+
+	movies := paginate(alsoLiked, limit, offset)
+	presentMovies(movies)
+	c.JSON(http.StatusOK, movies)
+}
+
+// HandleRecommend godoc
+// @Summary      Recommendations for the current profile
+// @Description  Movies liked by the people who liked the same movies as the profile, followed by movies similar to the ones the profile rated 4 or 5 or watched. Watched and rated movies are excluded
+// @Tags recommendations
+// @Accept       json
+// @Produce      json
+// @Param limit query int false "Page size, 10 by default and 50 at most"
+// @Param offset query int false "Number of movies to skip"
+// @Success      200  {array} models.Movie "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /me/recommendations [get]
+// @Security Bearer
+func (h *RecommendationsHandlers) HandleRecommend(c *gin.Context) {
+	limit, offset, err := parsePage(c, movieListDefaultLimit, movieListMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	profile := currentProfile(c)
+	candidates, err := h.moviesRepo.FindAll(c, models.MovieFilters{}, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	neighbours, err := h.neighboursRepo.FindByMovies(c, services.TasteMovieIds(candidates))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Profiles without ratings shared with others still get the movies similar to their taste
+	recommendations := services.MergeRankings(
+		services.CollaborativeRecommendations(candidates, neighbours),
+		services.RecommendMovies(candidates),
+	)
+
+	movies := paginate(recommendations, limit, offset)
+	presentMovies(movies)
+	c.JSON(http.StatusOK, movies)
+}
+
+func paginate[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return make([]T, 0)
+	}
+
+	return items[offset:min(offset+limit, len(items))]
+}
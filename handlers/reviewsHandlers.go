@@ -0,0 +1,594 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reviewsDefaultLimit = 20
+	reviewsMaxLimit     = 100
+	reviewMaxLength     = 5000
+)
+
+type ReviewsHandlers struct {
+	moviesRepo  *repositories.MoviesRepository
+	reviewsRepo *repositories.ReviewsRepository
+}
+
+func NewReviewsHandlers(moviesRepo *repositories.MoviesRepository, reviewsRepo *repositories.ReviewsRepository) *ReviewsHandlers {
+	return &ReviewsHandlers{moviesRepo: moviesRepo, reviewsRepo: reviewsRepo}
+}
+
+type reviewRequest struct {
+	Text      string `json:"text"`
+	IsSpoiler bool   `json:"isSpoiler"`
+	Rating    int    `json:"rating"`
+}
+
+type reportReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ReviewResponse struct {
+	Id           int       `json:"id"`
+	MovieId      int       `json:"movieId"`
+	AuthorName   string    `json:"authorName"`
+	Text         string    `json:"text"`
+	IsSpoiler    bool      `json:"isSpoiler"`
+	Rating       int       `json:"rating"`
+	Status       string    `json:"status"`
+	LikesCount   int       `json:"likesCount"`
+	ReportsCount int       `json:"reportsCount"`
+	IsLiked      bool      `json:"isLiked"`
+	IsOwn        bool      `json:"isOwn"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// HandleFindAll godoc
+// @Summary      Get movie reviews
+// @Description  Approved reviews and the reviews of the current profile, the newest first. The total number is in the X-Total-Count header
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param limit query int false "Page size, 20 by default and 100 at most"
+// @Param offset query int false "Number of reviews to skip"
+// @Success      200  {array} handlers.ReviewResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews [get]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleFindAll(c *gin.Context) {
+	movieId, ok := h.findMovie(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePage(c, reviewsDefaultLimit, reviewsMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	reviews, total, err := h.reviewsRepo.FindByMovie(c, movieId, c.GetInt("profileId"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, mapReviewsToResponse(c, reviews))
+}
+
+// HandleCreate godoc
+// @Summary      Write a review
+// @Description  The review is visible to others once an editor approves it
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param request body handlers.reviewRequest true "Review, the rating is from 1 to 5"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or the movie is already reviewed"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews [post]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleCreate(c *gin.Context) {
+	movieId, ok := h.findMovie(c)
+	if !ok {
+		return
+	}
+
+	var request reviewRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+	if !validateReviewRequest(c, &request) {
+		return
+	}
+
+	profileId := c.GetInt("profileId")
+	_, err := h.reviewsRepo.FindIdByAuthor(c, movieId, profileId)
+	if err == nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("The movie is already reviewed, edit the review instead"))
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	now := time.Now()
+	review := models.Review{
+		MovieId:   movieId,
+		UserId:    c.GetInt("userId"),
+		ProfileId: profileId,
+		Text:      request.Text,
+		IsSpoiler: request.IsSpoiler,
+		Rating:    request.Rating,
+		Status:    models.ReviewStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	review.Id, err = h.reviewsRepo.Create(c, review)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.create", "review", review.Id, nil, reviewSnapshot(review))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": review.Id})
+}
+
+// HandleUpdate godoc
+// @Summary      Edit a review
+// @Description  Only the author can edit the review, it goes back to moderation
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param reviewId path int true "Review id"
+// @Param request body handlers.reviewRequest true "Review, the rating is from 1 to 5"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 403  {object} models.ApiError "Not the author"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews/{reviewId} [put]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleUpdate(c *gin.Context) {
+	review, ok := h.findOwnReview(c)
+	if !ok {
+		return
+	}
+
+	var request reviewRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+	if !validateReviewRequest(c, &request) {
+		return
+	}
+
+	before := reviewSnapshot(review)
+	review.Text = request.Text
+	review.IsSpoiler = request.IsSpoiler
+	review.Rating = request.Rating
+	review.Status = models.ReviewStatusPending
+	review.UpdatedAt = time.Now()
+
+	err := h.reviewsRepo.Update(c, review)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.update", "review", review.Id, before, reviewSnapshot(review))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete a review
+// @Description  Only the author can delete the review
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param reviewId path int true "Review id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 403  {object} models.ApiError "Not the author"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews/{reviewId} [delete]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleDelete(c *gin.Context) {
+	review, ok := h.findOwnReview(c)
+	if !ok {
+		return
+	}
+
+	err := h.reviewsRepo.Delete(c, review.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.delete", "review", review.Id, reviewSnapshot(review), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleLike godoc
+// @Summary      Like a review
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param reviewId path int true "Review id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews/{reviewId}/like [post]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleLike(c *gin.Context) {
+	review, ok := h.findVisibleReview(c)
+	if !ok {
+		return
+	}
+
+	err := h.reviewsRepo.Like(c, review.Id, c.GetInt("profileId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.like", "review", review.Id, nil, gin.H{"profileId": c.GetInt("profileId")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleUnlike godoc
+// @Summary      Remove the like of a review
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param reviewId path int true "Review id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews/{reviewId}/like [delete]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleUnlike(c *gin.Context) {
+	review, ok := h.findVisibleReview(c)
+	if !ok {
+		return
+	}
+
+	err := h.reviewsRepo.Unlike(c, review.Id, c.GetInt("profileId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.unlike", "review", review.Id, gin.H{"profileId": c.GetInt("profileId")}, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleReport godoc
+// @Summary      Report a review
+// @Description  Reported reviews return to the moderation queue
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Movie id"
+// @Param reviewId path int true "Review id"
+// @Param request body handlers.reportReviewRequest true "What is wrong with the review"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{id}/reviews/{reviewId}/report [post]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleReport(c *gin.Context) {
+	review, ok := h.findVisibleReview(c)
+	if !ok {
+		return
+	}
+
+	var request reportReviewRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Reason == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Reason is required"))
+		return
+	}
+
+	report := models.ReviewReport{
+		ReviewId:  review.Id,
+		ProfileId: c.GetInt("profileId"),
+		Reason:    request.Reason,
+		CreatedAt: time.Now(),
+	}
+
+	err := h.reviewsRepo.Report(c, report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.report", "review", review.Id, nil, gin.H{"profileId": report.ProfileId, "reason": report.Reason})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleModerationQueue godoc
+// @Summary      Reviews waiting for moderation
+// @Description  New and edited reviews and the ones reported since they were last moderated, the oldest first
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param limit query int false "Page size, 20 by default and 100 at most"
+// @Param offset query int false "Number of reviews to skip"
+// @Success      200  {array} handlers.ReviewResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/moderation [get]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleModerationQueue(c *gin.Context) {
+	limit, offset, err := parsePage(c, reviewsDefaultLimit, reviewsMaxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	reviews, err := h.reviewsRepo.FindModerationQueue(c, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, mapReviewsToResponse(c, reviews))
+}
+
+// HandleApprove godoc
+// @Summary      Approve a review
+// @Description  Publishes the review and resolves its reports
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param reviewId path int true "Review id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/{reviewId}/approve [post]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleApprove(c *gin.Context) {
+	h.moderate(c, models.ReviewStatusApproved)
+}
+
+// HandleHide godoc
+// @Summary      Hide a review
+// @Description  Only the author sees a hidden review
+// @Tags reviews
+// @Accept       json
+// @Produce      json
+// @Param reviewId path int true "Review id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/{reviewId}/hide [post]
+// @Security Bearer
+func (h *ReviewsHandlers) HandleHide(c *gin.Context) {
+	h.moderate(c, models.ReviewStatusHidden)
+}
+
+func (h *ReviewsHandlers) moderate(c *gin.Context, status string) {
+	review, ok := h.findReview(c)
+	if !ok {
+		return
+	}
+
+	err := h.reviewsRepo.SetStatus(c, review.Id, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "review.moderate", "review", review.Id, gin.H{"status": review.Status}, gin.H{"status": status})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// findMovie makes sure the movie exists and the profile can see it.
+func (h *ReviewsHandlers) findMovie(c *gin.Context) (int, bool) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return 0, false
+	}
+
+	profile := currentProfile(c)
+	_, err = h.moviesRepo.FindById(c, movieId, &profile)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+		return 0, false
+	}
+
+	return movieId, true
+}
+
+func (h *ReviewsHandlers) findReview(c *gin.Context) (models.Review, bool) {
+	reviewId, err := strconv.Atoi(c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid review id"))
+		return models.Review{}, false
+	}
+
+	review, err := h.reviewsRepo.FindById(c, reviewId, c.GetInt("profileId"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Review not found"))
+		return models.Review{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Review{}, false
+	}
+
+	return review, true
+}
+
+// findVisibleReview returns a review of the movie in the path which the profile can see.
+func (h *ReviewsHandlers) findVisibleReview(c *gin.Context) (models.Review, bool) {
+	movieId, ok := h.findMovie(c)
+	if !ok {
+		return models.Review{}, false
+	}
+
+	review, ok := h.findReview(c)
+	if !ok {
+		return models.Review{}, false
+	}
+
+	isOwn := review.ProfileId == c.GetInt("profileId")
+	if review.MovieId != movieId || (review.Status != models.ReviewStatusApproved && !isOwn) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Review not found"))
+		return models.Review{}, false
+	}
+
+	return review, true
+}
+
+func (h *ReviewsHandlers) findOwnReview(c *gin.Context) (models.Review, bool) {
+	review, ok := h.findVisibleReview(c)
+	if !ok {
+		return models.Review{}, false
+	}
+
+	if review.ProfileId != c.GetInt("profileId") {
+		c.JSON(http.StatusForbidden, models.NewApiError("Only the author can change the review"))
+		return models.Review{}, false
+	}
+
+	return review, true
+}
+
+func validateReviewRequest(c *gin.Context, request *reviewRequest) bool {
+	request.Text = strings.TrimSpace(request.Text)
+	if request.Text == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Text is required"))
+		return false
+	}
+	if len([]rune(request.Text)) > reviewMaxLength {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Text is too long"))
+		return false
+	}
+	if request.Rating < 1 || request.Rating > 5 {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid rating value"))
+		return false
+	}
+
+	return true
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(c *gin.Context, defaultLimit int, maxLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		value, err := strconv.Atoi(limitStr)
+		if err != nil || value < 1 || value > maxLimit {
+			return 0, 0, errors.New("Invalid limit")
+		}
+		limit = value
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		value, err := strconv.Atoi(offsetStr)
+		if err != nil || value < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+		offset = value
+	}
+
+	return limit, offset, nil
+}
+
+func reviewSnapshot(review models.Review) gin.H {
+	return gin.H{
+		"movieId":   review.MovieId,
+		"profileId": review.ProfileId,
+		"text":      review.Text,
+		"isSpoiler": review.IsSpoiler,
+		"rating":    review.Rating,
+		"status":    review.Status,
+	}
+}
+
+func mapReviewsToResponse(c *gin.Context, reviews []models.Review) []ReviewResponse {
+	response := make([]ReviewResponse, 0, len(reviews))
+	for _, review := range reviews {
+		response = append(response, ReviewResponse{
+			Id:           review.Id,
+			MovieId:      review.MovieId,
+			AuthorName:   review.AuthorName,
+			Text:         review.Text,
+			IsSpoiler:    review.IsSpoiler,
+			Rating:       review.Rating,
+			Status:       review.Status,
+			LikesCount:   review.LikesCount,
+			ReportsCount: review.ReportsCount,
+			IsLiked:      review.IsLiked,
+			IsOwn:        review.ProfileId == c.GetInt("profileId"),
+			CreatedAt:    review.CreatedAt,
+			UpdatedAt:    review.UpdatedAt,
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"time"
+)
+
+type SessionsHandlers struct {
+	sessionsRepo *repositories.SessionsRepository
+}
+
+func NewSessionsHandlers(sessionsRepo *repositories.SessionsRepository) *SessionsHandlers {
+	return &SessionsHandlers{sessionsRepo: sessionsRepo}
+}
+
+type SessionResponse struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	IsCurrent  bool      `json:"isCurrent"`
+}
+
+// HandleFindAll godoc
+// @Summary      List active sessions
+// @Description  Devices the current user is signed in on, the most recently used first
+// @Tags auth
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} handlers.SessionResponse "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/sessions [get]
+// @Security Bearer
+func (h *SessionsHandlers) HandleFindAll(c *gin.Context) {
+	sessions, err := h.sessionsRepo.FindAllActive(c, c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	currentId := c.GetString("sessionId")
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Id:         session.Id,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			IsCurrent:  session.Id == currentId,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleRevoke godoc
+// @Summary      Revoke a session
+// @Description  Signs the device out, tokens of the session stop working immediately
+// @Tags auth
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Session id"
+// @Success      200  "OK"
+// @Failure   	 404  {object} models.ApiError "Session not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/sessions/{id} [delete]
+// @Security Bearer
+func (h *SessionsHandlers) HandleRevoke(c *gin.Context) {
+	revoked, err := h.sessionsRepo.Revoke(c, c.GetInt("userId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, models.NewApiError("Session not found"))
+		return
+	}
+
+	err = recordAudit(c, "session.revoke", "session", c.Param("id"), nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strconv"
+	"strings"
+)
+
+const (
+	tagsAutocompleteDefaultLimit = 10
+	tagsAutocompleteMaxLimit     = 50
+)
+
+type TagsHandlers struct {
+	repo *repositories.TagsRepository
+}
+
+func NewTagsHandlers(repo *repositories.TagsRepository) *TagsHandlers {
+	return &TagsHandlers{repo: repo}
+}
+
+type tagRequest struct {
+	Title string `json:"title"`
+}
+
+// HandleFindAll godoc
+// @Summary      Get tags list
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.Tag "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags [get]
+// @Security Bearer
+func (h *TagsHandlers) HandleFindAll(c *gin.Context) {
+	tags, err := h.repo.FindAll(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// HandleAutocomplete godoc
+// @Summary      Autocomplete tags
+// @Description  Tags containing the term, the ones starting with it and the most used first
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Param q query string true "Term"
+// @Param limit query int false "Number of tags, 10 by default and 50 at most"
+// @Success      200  {array} models.Tag "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags/autocomplete [get]
+// @Security Bearer
+func (h *TagsHandlers) HandleAutocomplete(c *gin.Context) {
+	term := strings.TrimSpace(c.Query("q"))
+	if term == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Term is required"))
+		return
+	}
+
+	limit := tagsAutocompleteDefaultLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		value, err := strconv.Atoi(limitStr)
+		if err != nil || value < 1 || value > tagsAutocompleteMaxLimit {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid limit"))
+			return
+		}
+		limit = value
+	}
+
+	tags, err := h.repo.Autocomplete(c, term, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// HandleFindById godoc
+// @Summary      Find tag by id
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Tag id"
+// @Success      200  {object} models.Tag "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid tag id"
+// @Failure   	 404  {object} models.ApiError "Tag not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags/{id} [get]
+// @Security Bearer
+func (h *TagsHandlers) HandleFindById(c *gin.Context) {
+	tag, ok := h.findTag(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// HandleCreate godoc
+// @Summary      Create tag
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.tagRequest true "Tag"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or the tag already exists"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags [post]
+// @Security Bearer
+func (h *TagsHandlers) HandleCreate(c *gin.Context) {
+	tag, ok := h.parseTag(c, 0)
+	if !ok {
+		return
+	}
+
+	id, err := h.repo.Create(c, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	tag.Id = id
+	err = recordAudit(c, "tag.create", "tag", id, nil, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// HandleUpdate godoc
+// @Summary      Update tag
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Tag id"
+// @Param request body handlers.tagRequest true "Tag"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or the tag already exists"
+// @Failure   	 404  {object} models.ApiError "Tag not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags/{id} [put]
+// @Security Bearer
+func (h *TagsHandlers) HandleUpdate(c *gin.Context) {
+	existing, ok := h.findTag(c)
+	if !ok {
+		return
+	}
+
+	tag, ok := h.parseTag(c, existing.Id)
+	if !ok {
+		return
+	}
+
+	tag.Id = existing.Id
+	err := h.repo.Update(c, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "tag.update", "tag", tag.Id, existing, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleDelete godoc
+// @Summary      Delete tag
+// @Description  The tag is removed from every movie
+// @Tags tags
+// @Accept       json
+// @Produce      json
+// @Param id path int true "Tag id"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid tag id"
+// @Failure   	 404  {object} models.ApiError "Tag not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /tags/{id} [delete]
+// @Security Bearer
+func (h *TagsHandlers) HandleDelete(c *gin.Context) {
+	tag, ok := h.findTag(c)
+	if !ok {
+		return
+	}
+
+	err := h.repo.Delete(c, tag.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "tag.delete", "tag", tag.Id, tag, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *TagsHandlers) findTag(c *gin.Context) (models.Tag, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid tag id"))
+		return models.Tag{}, false
+	}
+
+	tag, err := h.repo.FindById(c, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Tag not found"))
+		return models.Tag{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Tag{}, false
+	}
+
+	return tag, true
+}
+
+// parseTag reads the request, id is the tag being updated or 0 for a new one.
+func (h *TagsHandlers) parseTag(c *gin.Context, id int) (models.Tag, bool) {
+	var request tagRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return models.Tag{}, false
+	}
+
+	tag := models.Tag{Title: strings.TrimSpace(request.Title)}
+	if tag.Title == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Title is required"))
+		return models.Tag{}, false
+	}
+
+	existing, err := h.repo.FindByTitle(c, tag.Title)
+	if err == nil && existing.Id != id {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Tag already exists"))
+		return models.Tag{}, false
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return models.Tag{}, false
+	}
+
+	return tag, true
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"time"
+)
+
+type TwoFactorHandlers struct {
+	usersRepo     *repositories.UsersRepository
+	twoFactorRepo *repositories.TwoFactorRepository
+	loginThrottle *services.LoginThrottle
+}
+
+func NewTwoFactorHandlers(
+	usersRepo *repositories.UsersRepository,
+	twoFactorRepo *repositories.TwoFactorRepository,
+	loginThrottle *services.LoginThrottle,
+) *TwoFactorHandlers {
+	return &TwoFactorHandlers{usersRepo: usersRepo, twoFactorRepo: twoFactorRepo, loginThrottle: loginThrottle}
+}
+
+type enableTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type disableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type regenerateRecoveryCodesRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// HandleSetup godoc
+// @Summary      Start two-factor authentication enrolment
+// @Description  Returns a new TOTP secret and the otpauth:// uri to show as a QR code. The second factor is enabled once a code is confirmed
+// @Tags 2fa
+// @Accept       json
+// @Produce      json
+// @Success      200  {object} handlers.TwoFactorSetupResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Already enabled"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/2fa/setup [post]
+// @Security Bearer
+func (h *TwoFactorHandlers) HandleSetup(c *gin.Context) {
+	userId := c.GetInt("userId")
+	user, err := h.usersRepo.FindById(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	isEnabled, err := h.twoFactorRepo.IsEnabled(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if isEnabled {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := services.GenerateTotpSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.twoFactorRepo.SavePending(c, userId, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "twoFactor.setup", "user", userId, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningUri: services.TotpProvisioningUri(config.Config.TwoFactorIssuer, user.Email, secret),
+	})
+}
+
+// HandleEnable godoc
+// @Summary      Confirm two-factor authentication enrolment
+// @Description  Enables the second factor and returns recovery codes, they are shown only once
+// @Tags 2fa
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.enableTwoFactorRequest true "Code from the authenticator app"
+// @Success      200  {object} handlers.RecoveryCodesResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid code"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/2fa/enable [post]
+// @Security Bearer
+func (h *TwoFactorHandlers) HandleEnable(c *gin.Context) {
+	var request enableTwoFactorRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	userId := c.GetInt("userId")
+	twoFactor, err := h.twoFactorRepo.Find(c, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Two-factor authentication setup is not started"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if twoFactor.IsEnabled {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Two-factor authentication is already enabled"))
+		return
+	}
+
+	step, ok := services.VerifyTotpCode(twoFactor.Secret, request.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid code"))
+		return
+	}
+	_, err = h.twoFactorRepo.UseStep(c, userId, step)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	codes, err := h.replaceRecoveryCodes(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.twoFactorRepo.Enable(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "twoFactor.enable", "user", userId, gin.H{"isEnabled": false}, gin.H{"isEnabled": true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleDisable godoc
+// @Summary      Disable two-factor authentication
+// @Tags 2fa
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.disableTwoFactorRequest true "Password and a code or a recovery code"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid password or code"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/2fa/disable [post]
+// @Security Bearer
+func (h *TwoFactorHandlers) HandleDisable(c *gin.Context) {
+	var request disableTwoFactorRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	userId := c.GetInt("userId")
+	user, err := h.usersRepo.FindById(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	// Guesses count towards the sign in throttle of the account, a stolen session can't brute force them
+	attempt, ok := reserveLoginAttempt(c, h.loginThrottle, user.Email)
+	if !ok {
+		return
+	}
+
+	if matches, _ := services.VerifyPassword(user.PasswordHash, request.Password); !matches {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid password"))
+		return
+	}
+
+	ok, err = verifySecondFactor(c, h.twoFactorRepo, userId, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid code"))
+		return
+	}
+
+	err = h.loginThrottle.RegisterSuccess(c, attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.twoFactorRepo.Disable(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "twoFactor.disable", "user", userId, gin.H{"isEnabled": true}, gin.H{"isEnabled": false})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// HandleRegenerateRecoveryCodes godoc
+// @Summary      Regenerate recovery codes
+// @Description  Replaces all recovery codes, the previous ones stop working
+// @Tags 2fa
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.regenerateRecoveryCodesRequest true "Code or a recovery code"
+// @Success      200  {object} handlers.RecoveryCodesResponse "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid code"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /auth/2fa/recoveryCodes [post]
+// @Security Bearer
+func (h *TwoFactorHandlers) HandleRegenerateRecoveryCodes(c *gin.Context) {
+	var request regenerateRecoveryCodesRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	userId := c.GetInt("userId")
+	user, err := h.usersRepo.FindById(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	attempt, ok := reserveLoginAttempt(c, h.loginThrottle, user.Email)
+	if !ok {
+		return
+	}
+
+	ok, err = verifySecondFactor(c, h.twoFactorRepo, userId, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid code"))
+		return
+	}
+
+	err = h.loginThrottle.RegisterSuccess(c, attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	codes, err := h.replaceRecoveryCodes(c, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = recordAudit(c, "twoFactor.regenerateRecoveryCodes", "user", userId, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandlers) replaceRecoveryCodes(c *gin.Context, userId int) ([]string, error) {
+	codes, err := services.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, services.HashRecoveryCode(code))
+	}
+
+	return codes, h.twoFactorRepo.ReplaceRecoveryCodes(c, userId, hashes)
+}
+
+// verifySecondFactor accepts either a code from the authenticator app or an unused recovery code.
+// False is returned when two-factor authentication is not enabled for the user.
+func verifySecondFactor(c context.Context, repo *repositories.TwoFactorRepository, userId int, code string, recoveryCode string) (bool, error) {
+	twoFactor, err := repo.Find(c, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil || !twoFactor.IsEnabled {
+		return false, err
+	}
+
+	if recoveryCode != "" {
+		return repo.UseRecoveryCode(c, userId, services.HashRecoveryCode(recoveryCode))
+	}
+
+	step, ok := services.VerifyTotpCode(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return repo.UseStep(c, userId, step)
+}
@@ -1,20 +1,31 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jackc/pgx/v5"
+	"log"
 	"net/http"
 	"ozinshe-final-project/models"
 	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
 	"strconv"
 )
 
 type UserHandlers struct {
-	repo *repositories.UsersRepository
+	repo           *repositories.UsersRepository
+	userTokensRepo *repositories.UserTokensRepository
+	mailer         services.Mailer
+	loginThrottle  *services.LoginThrottle
 }
 
-func NewUserHandlers(repo *repositories.UsersRepository) *UserHandlers {
-	return &UserHandlers{repo: repo}
+func NewUserHandlers(
+	repo *repositories.UsersRepository,
+	userTokensRepo *repositories.UserTokensRepository,
+	mailer services.Mailer,
+	loginThrottle *services.LoginThrottle,
+) *UserHandlers {
+	return &UserHandlers{repo: repo, userTokensRepo: userTokensRepo, mailer: mailer, loginThrottle: loginThrottle}
 }
 
 type createUserRequest struct {
@@ -22,6 +33,7 @@ type createUserRequest struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirmPassword"`
+	Role            string `json:"role"`
 }
 
 type updateUserRequest struct {
@@ -29,15 +41,22 @@ type updateUserRequest struct {
 	Email string `json:"email"`
 }
 
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
 type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirmPassword"`
 }
 
 type UserResponse struct {
-	Id    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Id         int    `json:"id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	IsVerified bool   `json:"isVerified"`
+	Role       string `json:"role"`
 }
 
 // HandleFindAll godoc
@@ -115,16 +134,38 @@ func (h *UserHandlers) HandleCreate(c *gin.Context) {
 		return
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	request.Email = services.NormalizeEmail(request.Email)
+	if !h.validateEmail(c, request.Email, 0) {
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = models.RoleUser
+	}
+	if !models.IsValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid role"))
+		return
+	}
+
+	err := services.ValidatePassword(request.Password, request.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	passwordHash, err := services.HashPassword(request.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash password"))
 		return
 	}
 
+	// Users created by an existing user don't need to confirm their email
 	user := models.User{
 		Name:         request.Name,
 		Email:        request.Email,
-		PasswordHash: string(passwordHash),
+		PasswordHash: passwordHash,
+		IsVerified:   true,
+		Role:         request.Role,
 	}
 
 	id, err := h.repo.Create(c, user)
@@ -133,12 +174,20 @@ func (h *UserHandlers) HandleCreate(c *gin.Context) {
 		return
 	}
 
+	user.Id = id
+	err = recordAudit(c, "user.create", "user", id, nil, MapUserToResponse(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
 
 // HandleUpdate godoc
 // @Tags users
 // @Summary      Update user
+// @Description  A changed email has to be confirmed again by the link sent to it before the user can sign in
 // @Accept       json
 // @Produce      json
 // @Param id path int true "User id"
@@ -169,8 +218,18 @@ func (h *UserHandlers) HandleUpdate(c *gin.Context) {
 		return
 	}
 
+	request.Email = services.NormalizeEmail(request.Email)
+	emailChanged := request.Email != user.Email
+	if emailChanged && !h.validateEmail(c, request.Email, id) {
+		return
+	}
+
+	before := MapUserToResponse(user)
 	user.Name = request.Name
 	user.Email = request.Email
+	if emailChanged {
+		user.IsVerified = false
+	}
 
 	err = h.repo.Update(c, id, user)
 	if err != nil {
@@ -178,6 +237,75 @@ func (h *UserHandlers) HandleUpdate(c *gin.Context) {
 		return
 	}
 
+	err = recordAudit(c, "user.update", "user", id, before, MapUserToResponse(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	if emailChanged {
+		err = sendVerificationEmail(c, h.userTokensRepo, h.mailer, user)
+		if err != nil {
+			log.Printf("Failed to send verification email to user %d: %s", id, err)
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// HandleSetRole godoc
+// @Tags users
+// @Summary      Change user role
+// @Description  Roles of users signing in with the identity provider are overwritten on their next sign in
+// @Accept       json
+// @Produce      json
+// @Param id path int true "User id"
+// @Param request body handlers.setRoleRequest true "One of user, editor or admin"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "User not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /users/{id}/role [put]
+// @Security Bearer
+func (h *UserHandlers) HandleSetRole(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid user Id"))
+		return
+	}
+
+	var request setRoleRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if !models.IsValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid role"))
+		return
+	}
+
+	user, err := h.repo.FindById(c, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("User not found"))
+		return
+	}
+
+	err = h.repo.SetRole(c, id, request.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	before := MapUserToResponse(user)
+	user.Role = request.Role
+	err = recordAudit(c, "user.setRole", "user", id, before, MapUserToResponse(user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
 
@@ -201,7 +329,7 @@ func (h *UserHandlers) HandleDelete(c *gin.Context) {
 		return
 	}
 
-	_, err = h.repo.FindById(c, id)
+	user, err := h.repo.FindById(c, id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.NewApiError("User not found"))
 		return
@@ -213,12 +341,19 @@ func (h *UserHandlers) HandleDelete(c *gin.Context) {
 		return
 	}
 
+	err = recordAudit(c, "user.delete", "user", id, MapUserToResponse(user), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
 
 // HandleChangePassword godoc
 // @Tags users
 // @Summary      Change user password
+// @Description  currentPassword is required when users change their own password
 // @Accept       json
 // @Produce      json
 // @Param id path int true "User id"
@@ -226,6 +361,7 @@ func (h *UserHandlers) HandleDelete(c *gin.Context) {
 // @Success      200  "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid data"
 // @Failure   	 404  {object} models.ApiError "User not found"
+// @Failure   	 429  {object} models.ApiError "Too many failed attempts, see the Retry-After header"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /users/{id}/changePassword [put]
 // @Security Bearer
@@ -248,19 +384,45 @@ func (h *UserHandlers) HandleChangePassword(c *gin.Context) {
 		return
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	user, err := h.repo.FindById(c, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash password"))
+		c.JSON(http.StatusNotFound, models.NewApiError("User not found"))
 		return
 	}
 
-	user, err := h.repo.FindById(c, id)
+	// Administrators may set a password for others, but changing your own needs the current one.
+	// Guesses count towards the sign in throttle of the account, a stolen session can't brute force it
+	if id == c.GetInt("userId") {
+		attempt, ok := reserveLoginAttempt(c, h.loginThrottle, user.Email)
+		if !ok {
+			return
+		}
+
+		if matches, _ := services.VerifyPassword(user.PasswordHash, request.CurrentPassword); !matches {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Current password is incorrect"))
+			return
+		}
+
+		err = h.loginThrottle.RegisterSuccess(c, attempt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			return
+		}
+	}
+
+	err = services.ValidatePassword(request.Password, user.Email)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.NewApiError("User not found"))
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	passwordHash, err := services.HashPassword(request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to hash password"))
 		return
 	}
 
-	user.PasswordHash = string(passwordHash)
+	user.PasswordHash = passwordHash
 
 	err = h.repo.Update(c, id, user)
 	if err != nil {
@@ -268,17 +430,46 @@ func (h *UserHandlers) HandleChangePassword(c *gin.Context) {
 		return
 	}
 
+	// Password hashes never go into the log, only the fact that the password changed
+	err = recordAudit(c, "user.changePassword", "user", id, nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
 
+// validateEmail checks the email before it is saved, id is the user being updated or 0 for a new one.
+func (h *UserHandlers) validateEmail(c *gin.Context, email string, id int) bool {
+	if email == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Email is required"))
+		return false
+	}
+
+	existing, err := h.repo.FindByEmail(c, email)
+	if err == nil && existing.Id != id {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Email is already taken"))
+		return false
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return false
+	}
+
+	return true
+}
+
 func MapUsersToResponse(users []models.User) []UserResponse {
 	usersResponse := make([]UserResponse, 0, len(users))
 
 	for _, user := range users {
 		r := UserResponse{
-			Id:    user.Id,
-			Name:  user.Name,
-			Email: user.Email,
+			Id:         user.Id,
+			Name:       user.Name,
+			Email:      user.Email,
+			IsVerified: user.IsVerified,
+			Role:       user.Role,
 		}
 
 		usersResponse = append(usersResponse, r)
@@ -289,8 +480,10 @@ func MapUsersToResponse(users []models.User) []UserResponse {
 
 func MapUserToResponse(user models.User) UserResponse {
 	return UserResponse{
-		Id:    user.Id,
-		Name:  user.Name,
-		Email: user.Email,
+		Id:         user.Id,
+		Name:       user.Name,
+		Email:      user.Email,
+		IsVerified: user.IsVerified,
+		Role:       user.Role,
 	}
 }
@@ -11,10 +11,15 @@ import (
 type WatchlistHandler struct {
 	moviesRepo    *repositories.MoviesRepository
 	watchlistRepo *repositories.WatchlistRepository
+	eventsRepo    *repositories.MovieEventsRepository
 }
 
-func NewWatchlistHandler(moviesRepo *repositories.MoviesRepository, watchlistRepo *repositories.WatchlistRepository) *WatchlistHandler {
-	return &WatchlistHandler{moviesRepo: moviesRepo, watchlistRepo: watchlistRepo}
+func NewWatchlistHandler(
+	moviesRepo *repositories.MoviesRepository,
+	watchlistRepo *repositories.WatchlistRepository,
+	eventsRepo *repositories.MovieEventsRepository,
+) *WatchlistHandler {
+	return &WatchlistHandler{moviesRepo: moviesRepo, watchlistRepo: watchlistRepo, eventsRepo: eventsRepo}
 }
 
 // HandleGetMovies godoc
@@ -27,12 +32,13 @@ func NewWatchlistHandler(moviesRepo *repositories.MoviesRepository, watchlistRep
 // @Router       /watchlist [get]
 // @Security Bearer
 func (h *WatchlistHandler) HandleGetMovies(c *gin.Context) {
-	movies, err := h.watchlistRepo.GetMoviesFromWatchlist(c)
+	movies, err := h.watchlistRepo.GetMoviesFromWatchlist(c, currentProfile(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	presentMovies(movies)
 	c.JSON(http.StatusOK, movies)
 }
 
@@ -54,18 +60,26 @@ func (h *WatchlistHandler) HandleAddMovie(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
 		return
 	}
-	_, err = h.moviesRepo.FindById(c, id)
+	profile := currentProfile(c)
+	_, err = h.moviesRepo.FindById(c, id, &profile)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	err = h.watchlistRepo.AddToWatchlist(c, id)
+	err = h.watchlistRepo.AddToWatchlist(c, profile.Id, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	err = recordAudit(c, "watchlist.add", "movie", id, nil, gin.H{"profileId": profile.Id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	recordMovieEvent(c, h.eventsRepo, id, models.MovieEventWatchlist)
+
 	c.Status(http.StatusOK)
 }
 
@@ -88,13 +102,20 @@ func (h *WatchlistHandler) HandleRemoveMovie(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindById(c, id)
+	profile := currentProfile(c)
+	_, err = h.moviesRepo.FindById(c, id, &profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.watchlistRepo.RemoveFromWatchlist(c, profile.Id, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	err = h.watchlistRepo.RemoveFromWatchlist(c, id)
+	err = recordAudit(c, "watchlist.remove", "movie", id, gin.H{"profileId": profile.Id}, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
@@ -1,20 +1,27 @@
 create table movies
 (
-    id           serial primary key,
-    title        text not null,
-    description  text not null,
-    release_year int  not null,
-    director     text not null,
-    rating       int  not null default 0,
-    is_watched   bool not null default false,
-    trailer_url  text not null,
-    poster_id    text not null
+    id               serial primary key,
+    title            text   not null,
+    description      text   not null,
+    release_year     int    not null,
+    director         text   not null,
+    -- Age certification, 0+ to 18+, and the reasons for it
+    age_rating       int    not null default 18 check (age_rating in (0, 6, 12, 16, 18)),
+    advisories       text[] not null default '{}',
+    trailer_url      text   not null,
+    trailer_provider text   not null default '',
+    trailer_video_id text   not null default '',
+    poster_id        text   not null
 );
 
+-- Genres form a tree, e.g. Мультфильм > Аниме, siblings are shown in the order of position
 create table genres
 (
-    id    serial primary key,
-    title text not null
+    id        serial primary key,
+    title     text not null,
+    slug      text not null unique,
+    parent_id int references genres (id),
+    position  int  not null default 0
 );
 
 create table movie_genres
@@ -24,121 +31,487 @@ create table movie_genres
     primary key (movie_id, genre_id)
 );
 
-create table watchlist
+
+-- Free-form labels like «based on a true story», unique regardless of case
+create table tags
+(
+    id    serial primary key,
+    title text not null
+);
+
+create unique index tags_title_idx on tags (lower(title));
+
+create table movie_tags
+(
+    movie_id int not null references movies (id) on delete cascade,
+    tag_id   int not null references tags (id) on delete cascade,
+    primary key (movie_id, tag_id)
+);
+
+create table images
+(
+    id             text primary key,
+    hash           text   not null unique,
+    content_type   text   not null,
+    size           bigint not null,
+    ref_count      int    not null default 0,
+    blurhash       text   not null default '',
+    dominant_color text   not null default ''
+);
+
+create table movie_media
+(
+    id         serial primary key,
+    movie_id   int  not null references movies (id),
+    type       text not null,
+    url        text not null,
+    provider   text not null default '',
+    video_id   text not null default '',
+    language   text not null default '',
+    position   int  not null default 0,
+    is_primary bool not null default false
+);
+
+-- Only one primary poster per movie
+create unique index movie_media_primary_idx on movie_media (movie_id) where is_primary;
+
+-- Series of movies, watched in the order of release or of the story
+create table franchises
+(
+    id          serial primary key,
+    title       text not null,
+    description text not null default '',
+    watch_order text not null default 'release' check (watch_order in ('release', 'chronological'))
+);
+
+-- A movie belongs to one franchise at most, position is its place in the chronology of the story
+create table franchise_movies
+(
+    franchise_id int not null references franchises (id) on delete cascade,
+    movie_id     int not null unique references movies (id) on delete cascade,
+    position     int not null,
+    primary key (franchise_id, movie_id)
+);
+
+-- Shelves of the home screen curated by editors, shown within the publish window when it is set
+create table collections
 (
-    movie_id int primary key references movies (id),
-    added_at timestamp not null
+    id              serial primary key,
+    title           text      not null,
+    description     text      not null default '',
+    cover_id        text      not null default '',
+    position        int       not null default 0,
+    published_from  timestamp,
+    published_until timestamp,
+    created_at      timestamp not null,
+    updated_at      timestamp not null
+);
+
+create table collection_movies
+(
+    collection_id int not null references collections (id) on delete cascade,
+    movie_id      int not null references movies (id) on delete cascade,
+    position      int not null,
+    primary key (collection_id, movie_id)
 );
 
 create table users
 (
-    id            serial primary key,
-    name          text not null,
-    email         text not null unique,
-    password_hash text not null
+    id                serial primary key,
+    name              text not null,
+    email             text not null,
+    password_hash     text not null,
+    is_verified       bool not null default false,
+    role              text not null default 'user' check (role in ('user', 'editor', 'admin')),
+    -- Protects the age settings of profiles, parental controls are off without it
+    parental_pin_hash text
+);
+
+-- Emails are unique regardless of case
+create unique index users_email_idx on users (lower(email));
+
+create table user_tokens
+(
+    id         serial primary key,
+    user_id    int       not null references users (id) on delete cascade,
+    purpose    text      not null,
+    token_hash text      not null unique,
+    expires_at timestamp not null,
+    used_at    timestamp
+);
+
+create table user_two_factor
+(
+    user_id        int primary key references users (id) on delete cascade,
+    secret         text   not null,
+    is_enabled     bool   not null default false,
+    last_used_step bigint not null default 0
+);
+
+create table user_recovery_codes
+(
+    id        serial primary key,
+    user_id   int  not null references users (id) on delete cascade,
+    code_hash text not null,
+    used_at   timestamp
+);
+
+-- Viewers sharing an account, each user has exactly one default profile
+create table profiles
+(
+    id             serial primary key,
+    user_id        int       not null references users (id) on delete cascade,
+    name           text      not null,
+    avatar         text      not null default '',
+    language       text      not null default '',
+    is_kids        bool      not null default false,
+    max_age_rating int       not null default 18,
+    is_default     bool      not null default false,
+    created_at     timestamp not null
+);
+
+create unique index profiles_default_idx on profiles (user_id) where is_default;
+
+-- Ratings and watched state of a profile
+create table profile_movies
+(
+    profile_id int  not null references profiles (id) on delete cascade,
+    movie_id   int  not null references movies (id) on delete cascade,
+    rating     int  not null default 0,
+    is_watched bool not null default false,
+    primary key (profile_id, movie_id)
+);
+
+create table watchlist
+(
+    profile_id int       not null references profiles (id) on delete cascade,
+    movie_id   int       not null references movies (id) on delete cascade,
+    added_at   timestamp not null,
+    primary key (profile_id, movie_id)
+);
+
+-- Reviews wait for moderation until an editor approves them, one review per profile and movie
+create table reviews
+(
+    id           serial primary key,
+    movie_id     int       not null references movies (id) on delete cascade,
+    user_id      int       not null references users (id) on delete cascade,
+    profile_id   int       not null references profiles (id) on delete cascade,
+    text         text      not null,
+    is_spoiler   bool      not null default false,
+    rating       int       not null check (rating between 1 and 5),
+    status       text      not null default 'pending' check (status in ('pending', 'approved', 'hidden')),
+    created_at   timestamp not null,
+    updated_at   timestamp not null,
+    moderated_at timestamp,
+    unique (movie_id, profile_id)
+);
+
+create index reviews_status_idx on reviews (status);
+
+create table review_likes
+(
+    review_id  int       not null references reviews (id) on delete cascade,
+    profile_id int       not null references profiles (id) on delete cascade,
+    created_at timestamp not null,
+    primary key (review_id, profile_id)
+);
+
+create table review_reports
+(
+    review_id  int       not null references reviews (id) on delete cascade,
+    profile_id int       not null references profiles (id) on delete cascade,
+    reason     text      not null,
+    created_at timestamp not null,
+    primary key (review_id, profile_id)
+);
+
+-- Movies liked by the same people, recomputed in the background from the ratings of profiles
+create table movie_neighbours
+(
+    movie_id     int              not null references movies (id) on delete cascade,
+    neighbour_id int              not null references movies (id) on delete cascade,
+    score        double precision not null,
+    computed_at  timestamp        not null,
+    primary key (movie_id, neighbour_id)
+);
+
+-- What profiles do with movies, counted towards their popularity
+create table movie_events
+(
+    id         bigserial primary key,
+    movie_id   int       not null references movies (id) on delete cascade,
+    profile_id int       references profiles (id) on delete set null,
+    type       text      not null check (type in ('view', 'watch', 'rating', 'watchlist')),
+    created_at timestamp not null
+);
+
+create index movie_events_created_at_idx on movie_events (created_at);
+
+-- Decayed popularity of movies over each window, recomputed in the background from the events
+create table movie_popularity
+(
+    movie_id    int              not null references movies (id) on delete cascade,
+    time_window text             not null,
+    score       double precision not null,
+    computed_at timestamp        not null,
+    primary key (movie_id, time_window)
+);
+
+-- Accounts at the external identity provider, matched by the subject claim
+create table user_identities
+(
+    issuer      text not null,
+    subject     text not null,
+    user_id     int  not null references users (id) on delete cascade,
+    email       text not null,
+    -- Whether the user was created on the first sign in through the identity, not linked by email
+    provisioned bool not null default false,
+    primary key (issuer, subject)
+);
+
+-- Pending OpenID Connect logins, removed once the callback is handled
+create table oidc_login_states
+(
+    state_hash    text primary key,
+    code_verifier text      not null,
+    nonce         text      not null,
+    expires_at    timestamp not null
+);
+
+-- Signed in devices, access tokens refer to the session by id
+create table user_sessions
+(
+    id           text primary key,
+    user_id      int       not null references users (id) on delete cascade,
+    user_agent   text      not null default '',
+    ip           text      not null default '',
+    created_at   timestamp not null,
+    last_seen_at timestamp not null,
+    expires_at   timestamp not null,
+    revoked_at   timestamp
+);
+
+create index user_sessions_user_id_idx on user_sessions (user_id);
+
+-- Personal API tokens for scripts, only the hash of the token is stored
+create table api_tokens
+(
+    id           serial primary key,
+    user_id      int       not null references users (id) on delete cascade,
+    -- The profile the token acts as, the one it was created in
+    profile_id   int       not null references profiles (id) on delete cascade,
+    name         text      not null,
+    token_hash   text      not null unique,
+    -- The last characters of the token, to tell tokens apart in the list
+    hint         text      not null,
+    scopes       text[]    not null,
+    created_at   timestamp not null,
+    expires_at   timestamp,
+    last_used_at timestamp,
+    revoked_at   timestamp
+);
+
+-- Keys signing access tokens, retired keys keep verifying tokens until they expire
+create table signing_keys
+(
+    id          text primary key,
+    algorithm   text      not null,
+    private_key text      not null,
+    public_key  text      not null,
+    created_at  timestamp not null,
+    retired_at  timestamp,
+    expires_at  timestamp
+);
+
+-- Audit log of changes, actors are kept as plain ids so records outlive deleted users
+create table audit_events
+(
+    id                 bigserial primary key,
+    actor_user_id      int,
+    actor_api_token_id int,
+    action             text      not null,
+    entity_type        text      not null,
+    entity_id          text      not null,
+    before             jsonb,
+    after              jsonb,
+    ip                 text      not null default '',
+    created_at         timestamp not null
+);
+
+create index audit_events_created_at_idx on audit_events (created_at);
+create index audit_events_entity_idx on audit_events (entity_type, entity_id);
+create index audit_events_actor_user_id_idx on audit_events (actor_user_id);
+
+-- The audit log is append only, even for the application's own database user
+create function audit_events_append_only() returns trigger as
+$$
+begin
+    raise exception 'audit_events is append only';
+end;
+$$ language plpgsql;
+
+create trigger audit_events_append_only
+    before update or delete
+    on audit_events
+    for each row
+execute function audit_events_append_only();
+
+create trigger audit_events_no_truncate
+    before truncate
+    on audit_events
+    for each statement
+execute function audit_events_append_only();
+
+-- Sign in throttling counters, keyed by account email or client IP
+create table login_attempts
+(
+    key             text primary key,
+    failures        int       not null default 0,
+    last_failure_at timestamp not null,
+    blocked_until   timestamp not null
 );
 
 -- Seeding data
-insert into users (name, email, password_hash)
-values ('admin', 'admin@admin.com', '$2y$10$iCCKNv39bVatC7HelfyfGOLWi9cNYP2zmbb59vIraMMXSnzP5Nczq');
+insert into users (name, email, password_hash, is_verified, role)
+values ('admin', 'admin@admin.com', '$2y$10$iCCKNv39bVatC7HelfyfGOLWi9cNYP2zmbb59vIraMMXSnzP5Nczq', true, 'admin');
+
+insert into profiles (user_id, name, is_default, created_at)
+values (1, 'admin', true, now());
 
-insert into movies(title, description, release_year, director, rating, is_watched, trailer_url, poster_id)
+insert into movies(title, description, release_year, director, age_rating, advisories, trailer_url, trailer_provider, trailer_video_id, poster_id)
 values ('1+1',
         'Пострадав в результате несчастного случая, богатый аристократ Филипп нанимает в помощники человека, который менее всего подходит для этой работы, – молодого жителя предместья Дрисса, только что освободившегося из тюрьмы. Несмотря на то, что Филипп прикован к инвалидному креслу, Дриссу удается привнести в размеренную жизнь аристократа дух приключений.',
         2011,
         'Оливье Накаш',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=m95M-I7Ij0o&ab_channel=%D0%9A%D0%B8%D0%BD%D0%BE%D0%92%D0%B8%D1%85%D1%80%D1%8C',
+        16,
+        '{language}',
+        'https://www.youtube.com/watch?v=m95M-I7Ij0o',
+        'youtube',
+        'm95M-I7Ij0o',
         '1+1.jpg'),
        ('Интерстеллар ',
         'Когда засуха, пыльные бури и вымирание растений приводят человечество к продовольственному кризису, коллектив исследователей и учёных отправляется сквозь червоточину (которая предположительно соединяет области пространства-времени через большое расстояние) в путешествие, чтобы превзойти прежние ограничения для космических путешествий человека и найти планету с подходящими для человечества условиями.',
         2014,
         'Кристофер Нолан',
-        0,
-        false,
+        12,
+        '{}',
         'https://www.youtube.com/watch?v=6ybBuTETr3U',
+        'youtube',
+        '6ybBuTETr3U',
         'Interstellar.jpg'),
        ('Побег из Шоушенка',
         'Бухгалтер Энди Дюфрейн обвинён в убийстве собственной жены и её любовника. Оказавшись в тюрьме под названием Шоушенк, он сталкивается с жестокостью и беззаконием, царящими по обе стороны решётки. Каждый, кто попадает в эти стены, становится их рабом до конца жизни. Но Энди, обладающий живым умом и доброй душой, находит подход как к заключённым, так и к охранникам, добиваясь их особого к себе расположения.',
         1994,
         'Фрэнк Дарабонт',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=kgAeKpAPOYk&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        16,
+        '{violence,language}',
+        'https://www.youtube.com/watch?v=kgAeKpAPOYk',
+        'youtube',
+        'kgAeKpAPOYk',
         'The Shawshank Redemption.jpg'),
        ('Зеленая миля',
         'Пол Эджкомб — начальник блока смертников в тюрьме «Холодная гора», каждый из узников которого однажды проходит «зеленую милю» по пути к месту казни. Пол повидал много заключённых и надзирателей за время работы. Однако гигант Джон Коффи, обвинённый в страшном преступлении, стал одним из самых необычных обитателей блока.',
         1999,
         'Фрэнк Дарабонт',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=TODt_q-_4C4&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        16,
+        '{violence}',
+        'https://www.youtube.com/watch?v=TODt_q-_4C4',
+        'youtube',
+        'TODt_q-_4C4',
         'The Green Mile.jpg'),
        ('Бойцовский клуб',
         'Сотрудник страховой компании страдает хронической бессонницей и отчаянно пытается вырваться из мучительно скучной жизни. Однажды в очередной командировке он встречает некоего Тайлера Дёрдена — харизматического торговца мылом с извращенной философией. Тайлер уверен, что самосовершенствование — удел слабых, а единственное, ради чего стоит жить, — саморазрушение.
 Проходит немного времени, и вот уже новые друзья лупят друг друга почем зря на стоянке перед баром, и очищающий мордобой доставляет им высшее блаженство. Приобщая других мужчин к простым радостям физической жестокости, они основывают тайный Бойцовский клуб, который начинает пользоваться невероятной популярностью.',
         1999,
         'Дэвид Финчер',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=C7-7qQ61QHU&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        18,
+        '{violence,language,drugs}',
+        'https://www.youtube.com/watch?v=C7-7qQ61QHU',
+        'youtube',
+        'C7-7qQ61QHU',
         'Fight Club.jpg'),
        ('Остров проклятых',
         'Два американских судебных пристава отправляются на один из островов в штате Массачусетс, чтобы расследовать исчезновение пациентки клиники для умалишенных преступников. При проведении расследования им придется столкнуться с паутиной лжи, обрушившимся ураганом и смертельным бунтом обитателей клиники.',
         2009,
         'Мартин Скорсезе',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=_l7R9Rz5URw&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        18,
+        '{violence,horror}',
+        'https://www.youtube.com/watch?v=_l7R9Rz5URw',
+        'youtube',
+        '_l7R9Rz5URw',
         'Shutter Island.jpg'),
        ('Форрест Гамп',
         'Сидя на автобусной остановке, Форрест Гамп — не очень умный, но добрый и открытый парень — рассказывает случайным встречным историю своей необыкновенной жизни.
 С самого малолетства парень страдал от заболевания ног, соседские мальчишки дразнили его, но в один прекрасный день Форрест открыл в себе невероятные способности к бегу. Подруга детства Дженни всегда его поддерживала и защищала, но вскоре дороги их разошлись.',
         1994,
         'Роберт Земекис',
-        0,
-        false,
+        12,
+        '{}',
         'https://www.youtube.com/watch?v=otmeAaifX04',
+        'youtube',
+        'otmeAaifX04',
         'Forrest Gump.jpg'),
        ('Унесённые призраками',
         'Тихиро с мамой и папой переезжает в новый дом. Заблудившись по дороге, они оказываются в странном пустынном городе, где их ждет великолепный пир. Родители с жадностью набрасываются на еду и к ужасу девочки превращаются в свиней, став пленниками злой колдуньи Юбабы. Теперь, оказавшись одна среди волшебных существ и загадочных видений, Тихиро должна придумать, как избавить своих родителей от чар коварной старухи.',
         2001,
         'Хаяо Миядзаки',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=bgxiTkAlQrw&ab_channel=iVideos',
+        6,
+        '{}',
+        'https://www.youtube.com/watch?v=bgxiTkAlQrw',
+        'youtube',
+        'bgxiTkAlQrw',
         'Sen to Chihiro no kamikakushi.jpg'),
        ('Властелин колец: Возвращение короля',
         'Повелитель сил тьмы Саурон направляет свою бесчисленную армию под стены Минас-Тирита, крепости Последней Надежды. Он предвкушает близкую победу, но именно это мешает ему заметить две крохотные фигурки — хоббитов, приближающихся к Роковой Горе, где им предстоит уничтожить Кольцо Всевластья.',
         2003,
         'Питер Джексон',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=lxAeV1-KpSA&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        12,
+        '{violence}',
+        'https://www.youtube.com/watch?v=lxAeV1-KpSA',
+        'youtube',
+        'lxAeV1-KpSA',
         'lord_of_the_rings.jpg'),
        ('Леон',
         'Профессиональный убийца Леон неожиданно для себя самого решает помочь 12-летней соседке Матильде, семью которой убили коррумпированные полицейские.',
         1994,
         'Люк Бессон',
-        0,
-        false,
-        'https://www.youtube.com/watch?v=hvya_q8KM80&ab_channel=%D0%A2%D1%80%D0%B5%D0%B9%D0%BB%D0%B5%D1%80%D1%8B%D0%BA%D1%84%D0%B8%D0%BB%D1%8C%D0%BC%D0%B0%D0%BC',
+        18,
+        '{violence,language,drugs}',
+        'https://www.youtube.com/watch?v=hvya_q8KM80',
+        'youtube',
+        'hvya_q8KM80',
         'leon.jpg');
 
-insert into genres(title)
-values ('Драма'),
-       ('Комедия'),
-       ('Фантастика'),
-       ('Приключения'),
-       ('Фэнтези'),
-       ('Криминал'),
-       ('Триллер'),
-       ('Детектив'),
-       ('Мелодрама'),
-       ('Аниме'),
-       ('Мультфильм'),
-       ('Боевик');
+insert into images(id, hash, content_type, size, ref_count, blurhash, dominant_color)
+values ('1+1.jpg', '62c3f9d31673c8a12d9d74df6868d7268bffe49037396e96564281d9aedc204f', 'image/png', 160499, 1, 'LKDSBu~B=|-;-nE1IVt89}9u9uR+', '#010103'),
+       ('Interstellar.jpg', 'f42cd58588cea50025a9144a4bfdc82dfbcf3f69b5bb988c0559959126cc88d7', 'image/png', 257626, 1, 'LsI5=3t7ofj]_Nogfkj[RPaxWBay', '#c7d4d9'),
+       ('The Shawshank Redemption.jpg', 'cd401de92ce9f4b8307cc90bff9cd7e3beacdbdc33101a342158a3cac857291b', 'image/png', 262481, 1, 'LLF=guI9M}Ny}+xvayNH4:xsxuf8', '#030607'),
+       ('The Green Mile.jpg', '12450aec20190fdf9ad2f40c3827cf28a8a1ae900c8455019ccf7acfd272f35a', 'image/png', 128156, 1, 'LBAcJCjKNEELMvR.xtWC1hNGsp-V', '#0a0807'),
+       ('Fight Club.jpg', '6d50b0daad7420fe64aced5d378d33e2061d0acc8b7b02276bc4b1a5836762ac', 'image/png', 248969, 1, 'LiJ7Ei$lM}Jjo5ahxGxZ0#S0RjVu', '#080907'),
+       ('Shutter Island.jpg', 'e2e26d9fd4046a7854f0a8f3230470f1eb1b01adede4ad321573ea8bb25f626a', 'image/png', 172865, 1, 'LFBfeE0L56^+XmRjRPxu0L?Gs:E2', '#050507'),
+       ('Forrest Gump.jpg', '5d423f14a526b867ce39a18ff553d0f67eef277dd569244d766ce08e26737878', 'image/png', 110046, 1, 'LHJ9V@Ng9%%2t.RPV?bw0Mt6xZRk', '#b7d5eb'),
+       ('Sen to Chihiro no kamikakushi.jpg', 'edf692addb27340192f1b813705b73e31b2fa8c43d2d1b59ad65ebaae4416fa3', 'image/png', 130294, 1, 'LHBVR[t60yIp0}WB$jxtWDWCxaoM', '#000000'),
+       ('lord_of_the_rings.jpg', '7e4be47d1fa7b9178a3ea004a1847a70e352b87fe25c8eec96418d05003921c4', 'image/png', 228391, 1, 'LODlcuaeNGt7oKMxWBof0LxtxaR*', '#020202'),
+       ('leon.jpg', 'e8d1d2d409b63a3edbb7aa5f1d13862beed83820a536dc8a87a4c1d6b7d80c0a', 'image/png', 218350, 1, 'LXJaWH~pW:tR_1?G%1ozOWwaV?IV', '#141416');
+
+insert into genres(title, slug, position)
+values ('Драма', 'drama', 0),
+       ('Комедия', 'komediya', 1),
+       ('Фантастика', 'fantastika', 2),
+       ('Приключения', 'priklyucheniya', 3),
+       ('Фэнтези', 'fentezi', 4),
+       ('Криминал', 'kriminal', 5),
+       ('Триллер', 'triller', 6),
+       ('Детектив', 'detektiv', 7),
+       ('Мелодрама', 'melodrama', 8),
+       ('Аниме', 'anime', 0),
+       ('Мультфильм', 'multfilm', 9),
+       ('Боевик', 'boevik', 10);
+
+update genres
+set parent_id = 11
+where slug = 'anime';
 
 insert into movie_genres(movie_id, genre_id)
 values (1, 1),
@@ -167,4 +540,25 @@ values (1, 1),
        (9, 1),
        (10, 12),
        (10, 7),
-       (10, 1);
\ No newline at end of file
+       (10, 1);
+
+insert into tags(title)
+values ('Основано на реальных событиях'),
+       ('Неожиданная развязка'),
+       ('По книге');
+
+insert into movie_tags(movie_id, tag_id)
+values (1, 1),
+       (4, 3),
+       (5, 2),
+       (5, 3),
+       (6, 2),
+       (6, 3),
+       (7, 3),
+       (9, 3);
+
+insert into franchises(title, description, watch_order)
+values ('Властелин колец', 'Экранизации романов Дж. Р. Р. Толкина о Средиземье.', 'release');
+
+insert into franchise_movies(franchise_id, movie_id, position)
+values (1, 9, 0);
\ No newline at end of file
@@ -2,18 +2,24 @@ package main
 
 import (
 	"context"
+	"fmt"
 	cors "github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/spf13/viper"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"golang.org/x/crypto/bcrypt"
 	"log"
+	"os"
 	"ozinshe-final-project/config"
 	"ozinshe-final-project/docs"
 	"ozinshe-final-project/handlers"
 	"ozinshe-final-project/middlewares"
+	"ozinshe-final-project/models"
 	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
+	"strings"
 )
 
 // @title           Ozinshe API
@@ -53,6 +59,12 @@ func main() {
 		log.Fatal("Error reading config file", err)
 	}
 
+	// Client IPs are taken from X-Forwarded-For only when the request comes through one of the proxies
+	err = r.SetTrustedProxies(config.Config.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES", err)
+	}
+
 	conn, err := connectToDb()
 	if err != nil {
 		log.Fatal("Unable to connect to db", err)
@@ -61,49 +73,208 @@ func main() {
 
 	genresRepository := repositories.NewGenresRepository(conn)
 	genreHandlers := handlers.NewGenreHandlers(genresRepository)
+	imagesRepository := repositories.NewImagesRepository(conn)
+	postersService := services.NewPostersService(imagesRepository)
+
+	// Maintenance commands run instead of the server, e.g. `ozinshe-go backfill-posters`
+	if len(os.Args) > 1 {
+		err = runCommand(os.Args[1], postersService)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	moviesRepository := repositories.NewMoviesRepository(conn)
-	moviesHandler := handlers.NewMoviesHandler(moviesRepository, genresRepository)
+	mediaRepository := repositories.NewMediaRepository(conn)
+	movieEventsRepository := repositories.NewMovieEventsRepository(conn)
+	services.NewPopularityService(movieEventsRepository).StartRefresh(context.Background())
+	franchisesRepository := repositories.NewFranchisesRepository(conn)
+	tagsRepository := repositories.NewTagsRepository(conn)
+	tagsHandlers := handlers.NewTagsHandlers(tagsRepository)
+	moviesHandler := handlers.NewMoviesHandler(
+		moviesRepository,
+		genresRepository,
+		tagsRepository,
+		mediaRepository,
+		movieEventsRepository,
+		franchisesRepository,
+		postersService,
+	)
+	franchisesHandlers := handlers.NewFranchisesHandlers(franchisesRepository, moviesRepository)
+	mediaHandlers := handlers.NewMediaHandlers(moviesRepository, mediaRepository, postersService)
 	watchlistRepository := repositories.NewWatchlistRepository(conn)
-	watchlistHandlers := handlers.NewWatchlistHandler(moviesRepository, watchlistRepository)
+	watchlistHandlers := handlers.NewWatchlistHandler(moviesRepository, watchlistRepository, movieEventsRepository)
 	usersRepository := repositories.NewUsersRepository(conn)
-	userHandlers := handlers.NewUserHandlers(usersRepository)
-	authHandlers := handlers.NewAuthHandlers(usersRepository)
-	imageHandlers := handlers.NewImageHandlers()
+	userTokensRepository := repositories.NewUserTokensRepository(conn)
+	mailer := services.NewMailer()
+	loginAttemptsRepository := repositories.NewLoginAttemptsRepository(conn)
+	loginThrottle := services.NewLoginThrottle(loginAttemptsRepository)
+	loginThrottle.StartCleanup(context.Background())
+	userHandlers := handlers.NewUserHandlers(usersRepository, userTokensRepository, mailer, loginThrottle)
+	twoFactorRepository := repositories.NewTwoFactorRepository(conn)
+	sessionsRepository := repositories.NewSessionsRepository(conn)
+	jwtService := services.NewJwtService(repositories.NewSigningKeysRepository(conn))
+	err = jwtService.Init(context.Background())
+	if err != nil {
+		log.Fatal("Unable to load signing keys", err)
+	}
+	jwtService.StartRotation(context.Background())
+	oidcService := services.NewOidcService(repositories.NewOidcStatesRepository(conn))
+	authHandlers := handlers.NewAuthHandlers(
+		usersRepository,
+		userTokensRepository,
+		twoFactorRepository,
+		sessionsRepository,
+		repositories.NewUserIdentitiesRepository(conn),
+		jwtService,
+		oidcService,
+		mailer,
+		loginThrottle,
+		services.NewMailThrottle(loginAttemptsRepository),
+	)
+	sessionsHandlers := handlers.NewSessionsHandlers(sessionsRepository)
+	apiTokensRepository := repositories.NewApiTokensRepository(conn)
+	apiTokensHandlers := handlers.NewApiTokensHandlers(apiTokensRepository)
+	twoFactorHandlers := handlers.NewTwoFactorHandlers(usersRepository, twoFactorRepository, loginThrottle)
+	imageHandlers := handlers.NewImageHandlers(postersService)
+	profilesRepository := repositories.NewProfilesRepository(conn)
+	profilesHandlers := handlers.NewProfilesHandlers(profilesRepository, usersRepository, sessionsRepository, jwtService, loginThrottle)
+	auditRepository := repositories.NewAuditRepository(conn)
+	auditHandlers := handlers.NewAuditHandlers(auditRepository)
+	reviewsRepository := repositories.NewReviewsRepository(conn)
+	reviewsHandlers := handlers.NewReviewsHandlers(moviesRepository, reviewsRepository)
+	movieNeighboursRepository := repositories.NewMovieNeighboursRepository(conn)
+	services.NewNeighboursService(movieNeighboursRepository).StartRefresh(context.Background())
+	recommendationsHandlers := handlers.NewRecommendationsHandlers(moviesRepository, movieNeighboursRepository)
+	collectionsRepository := repositories.NewCollectionsRepository(conn)
+	collectionsHandlers := handlers.NewCollectionsHandlers(collectionsRepository, moviesRepository, usersRepository, postersService)
+	homeHandlers := handlers.NewHomeHandlers(collectionsRepository, moviesRepository, genresRepository)
+
+	// Registered before the routes so that every group records the audit events of its handlers
+	r.Use(middlewares.AuditMiddleware(auditRepository))
 
 	authorized := r.Group("/")
-	authorized.Use(middlewares.AuthMiddleware)
-
-	authorized.GET("genres", genreHandlers.HandleFindAll)
-	authorized.GET("genres/:id", genreHandlers.HandleFindById)
-	authorized.POST("genres", genreHandlers.HandleCreate)
-	authorized.PUT("genres/:id", genreHandlers.HandleUpdate)
-	authorized.DELETE("genres/:id", genreHandlers.HandleDelete)
-
-	authorized.GET("movies", moviesHandler.HandleFindAll)
-	authorized.GET("movies/:id", moviesHandler.HandleFindById)
-	authorized.POST("movies", moviesHandler.HandleCreate)
-	authorized.PUT("movies/:id", moviesHandler.HandleUpdate)
-	authorized.DELETE("movies/:id", moviesHandler.HandleDelete)
-	authorized.PATCH("movies/:id/rate", moviesHandler.HandleSetRating)
-	authorized.PATCH("movies/:id/setWatched", moviesHandler.HandleSetWatched)
-
-	authorized.GET("watchlist", watchlistHandlers.HandleGetMovies)
-	authorized.POST("watchlist/:movieId", watchlistHandlers.HandleAddMovie)
-	authorized.DELETE("watchlist/:movieId", watchlistHandlers.HandleRemoveMovie)
-
-	authorized.GET("users", userHandlers.HandleFindAll)
-	authorized.GET("users/:id", userHandlers.HandleFindById)
-	authorized.POST("users", userHandlers.HandleCreate)
-	authorized.PUT("users/:id", userHandlers.HandleUpdate)
-	authorized.PUT("users/:id/changePassword", userHandlers.HandleChangePassword)
-	authorized.DELETE("users/:id", userHandlers.HandleDelete)
+	authorized.Use(middlewares.AuthMiddleware(jwtService, sessionsRepository, apiTokensRepository))
+	authorized.Use(middlewares.ProfileMiddleware(profilesRepository, usersRepository))
+
+	requireEditor := middlewares.RequireRole(usersRepository, models.RoleEditor, models.RoleAdmin)
+	requireAdmin := middlewares.RequireRole(usersRepository, models.RoleAdmin)
+	requireSelfOrAdmin := middlewares.RequireSelfOrRole(usersRepository, "id", models.RoleAdmin)
+
+	// API tokens only reach the routes their scopes allow, account management needs a signed in session
+	catalogRead := authorized.Group("", middlewares.RequireScope(models.ScopeCatalogRead))
+	catalogWrite := authorized.Group("", middlewares.RequireScope(models.ScopeCatalogWrite))
+	libraryRead := authorized.Group("", middlewares.RequireScope(models.ScopeLibraryRead))
+	libraryWrite := authorized.Group("", middlewares.RequireScope(models.ScopeLibraryWrite))
+	usersRead := authorized.Group("", middlewares.RequireScope(models.ScopeUsersRead))
+	usersWrite := authorized.Group("", middlewares.RequireScope(models.ScopeUsersWrite))
+	auditRead := authorized.Group("", middlewares.RequireScope(models.ScopeAuditRead))
+	account := authorized.Group("", middlewares.RequireSession())
+
+	catalogRead.GET("genres", genreHandlers.HandleFindAll)
+	catalogRead.GET("genres/:id", genreHandlers.HandleFindById)
+	catalogWrite.POST("genres", requireEditor, genreHandlers.HandleCreate)
+	catalogWrite.PUT("genres/:id", requireEditor, genreHandlers.HandleUpdate)
+	catalogWrite.DELETE("genres/:id", requireEditor, genreHandlers.HandleDelete)
+
+	catalogRead.GET("tags", tagsHandlers.HandleFindAll)
+	catalogRead.GET("tags/autocomplete", tagsHandlers.HandleAutocomplete)
+	catalogRead.GET("tags/:id", tagsHandlers.HandleFindById)
+	catalogWrite.POST("tags", requireEditor, tagsHandlers.HandleCreate)
+	catalogWrite.PUT("tags/:id", requireEditor, tagsHandlers.HandleUpdate)
+	catalogWrite.DELETE("tags/:id", requireEditor, tagsHandlers.HandleDelete)
+
+	catalogRead.GET("movies", moviesHandler.HandleFindAll)
+	catalogRead.GET("movies/trending", moviesHandler.HandleFindTrending)
+	catalogRead.GET("movies/:id", moviesHandler.HandleFindById)
+	catalogWrite.POST("movies", requireEditor, moviesHandler.HandleCreate)
+	catalogWrite.PUT("movies/:id", requireEditor, moviesHandler.HandleUpdate)
+	catalogWrite.DELETE("movies/:id", requireEditor, moviesHandler.HandleDelete)
+	libraryWrite.PATCH("movies/:id/rate", moviesHandler.HandleSetRating)
+	libraryWrite.PATCH("movies/:id/setWatched", moviesHandler.HandleSetWatched)
+
+	catalogRead.GET("movies/:id/similar", recommendationsHandlers.HandleFindSimilar)
+	catalogRead.GET("movies/:id/alsoLiked", recommendationsHandlers.HandleFindAlsoLiked)
+	libraryRead.GET("me/recommendations", recommendationsHandlers.HandleRecommend)
+
+	catalogRead.GET("movies/:id/media", mediaHandlers.HandleFindAll)
+	catalogWrite.POST("movies/:id/media", requireEditor, mediaHandlers.HandleCreate)
+	catalogWrite.PUT("movies/:id/media/:mediaId", requireEditor, mediaHandlers.HandleUpdate)
+	catalogWrite.DELETE("movies/:id/media/:mediaId", requireEditor, mediaHandlers.HandleDelete)
+
+	catalogRead.GET("movies/:id/reviews", reviewsHandlers.HandleFindAll)
+	libraryWrite.POST("movies/:id/reviews", reviewsHandlers.HandleCreate)
+	libraryWrite.PUT("movies/:id/reviews/:reviewId", reviewsHandlers.HandleUpdate)
+	libraryWrite.DELETE("movies/:id/reviews/:reviewId", reviewsHandlers.HandleDelete)
+	libraryWrite.POST("movies/:id/reviews/:reviewId/like", reviewsHandlers.HandleLike)
+	libraryWrite.DELETE("movies/:id/reviews/:reviewId/like", reviewsHandlers.HandleUnlike)
+	libraryWrite.POST("movies/:id/reviews/:reviewId/report", reviewsHandlers.HandleReport)
+	catalogRead.GET("reviews/moderation", requireEditor, reviewsHandlers.HandleModerationQueue)
+	catalogWrite.POST("reviews/:reviewId/approve", requireEditor, reviewsHandlers.HandleApprove)
+	catalogWrite.POST("reviews/:reviewId/hide", requireEditor, reviewsHandlers.HandleHide)
+
+	catalogRead.GET("collections", collectionsHandlers.HandleFindAll)
+	catalogRead.GET("collections/:id", collectionsHandlers.HandleFindById)
+	catalogWrite.POST("collections", requireEditor, collectionsHandlers.HandleCreate)
+	catalogWrite.PUT("collections/:id", requireEditor, collectionsHandlers.HandleUpdate)
+	catalogWrite.DELETE("collections/:id", requireEditor, collectionsHandlers.HandleDelete)
+
+	catalogRead.GET("franchises", franchisesHandlers.HandleFindAll)
+	catalogRead.GET("franchises/:id", franchisesHandlers.HandleFindById)
+	catalogWrite.POST("franchises", requireEditor, franchisesHandlers.HandleCreate)
+	catalogWrite.PUT("franchises/:id", requireEditor, franchisesHandlers.HandleUpdate)
+	catalogWrite.DELETE("franchises/:id", requireEditor, franchisesHandlers.HandleDelete)
+
+	catalogRead.GET("home", homeHandlers.HandleGetHome)
+
+	libraryRead.GET("watchlist", watchlistHandlers.HandleGetMovies)
+	libraryWrite.POST("watchlist/:movieId", watchlistHandlers.HandleAddMovie)
+	libraryWrite.DELETE("watchlist/:movieId", watchlistHandlers.HandleRemoveMovie)
+
+	usersRead.GET("users", requireAdmin, userHandlers.HandleFindAll)
+	usersRead.GET("users/:id", requireSelfOrAdmin, userHandlers.HandleFindById)
+	usersWrite.POST("users", requireAdmin, userHandlers.HandleCreate)
+	usersWrite.PUT("users/:id", requireSelfOrAdmin, userHandlers.HandleUpdate)
+	account.PUT("users/:id/changePassword", requireSelfOrAdmin, userHandlers.HandleChangePassword)
+	usersWrite.PUT("users/:id/role", requireAdmin, userHandlers.HandleSetRole)
+	usersWrite.DELETE("users/:id", requireAdmin, userHandlers.HandleDelete)
+
+	usersRead.GET("profiles", profilesHandlers.HandleFindAll)
+	account.POST("profiles", profilesHandlers.HandleCreate)
+	account.PUT("profiles/:id", profilesHandlers.HandleUpdate)
+	account.DELETE("profiles/:id", profilesHandlers.HandleDelete)
+	account.POST("profiles/:id/select", profilesHandlers.HandleSelect)
+	account.PUT("auth/parentalPin", profilesHandlers.HandleSetParentalPin)
+
+	catalogRead.GET("images/hash/:hash", imageHandlers.HandleFindByHash)
+
+	auditRead.GET("audit", requireAdmin, auditHandlers.HandleFindAll)
 
 	authorized.GET("auth/userInfo", authHandlers.HandleGetUserInfo)
-	authorized.POST("auth/signOut", authHandlers.HandleSignOut)
+	account.POST("auth/signOut", authHandlers.HandleSignOut)
+	account.GET("auth/sessions", sessionsHandlers.HandleFindAll)
+	account.DELETE("auth/sessions/:id", sessionsHandlers.HandleRevoke)
+	account.GET("auth/tokens", apiTokensHandlers.HandleFindAll)
+	account.POST("auth/tokens", apiTokensHandlers.HandleCreate)
+	account.DELETE("auth/tokens/:id", apiTokensHandlers.HandleRevoke)
+	account.POST("auth/2fa/setup", twoFactorHandlers.HandleSetup)
+	account.POST("auth/2fa/enable", twoFactorHandlers.HandleEnable)
+	account.POST("auth/2fa/disable", twoFactorHandlers.HandleDisable)
+	account.POST("auth/2fa/recoveryCodes", twoFactorHandlers.HandleRegenerateRecoveryCodes)
 
 	unauthorized := r.Group("")
 	unauthorized.POST("auth/signIn", authHandlers.HandleSignIn)
+	unauthorized.POST("auth/signIn/2fa", authHandlers.HandleSignInTwoFactor)
+	unauthorized.POST("auth/signUp", authHandlers.HandleSignUp)
+	unauthorized.POST("auth/resendVerification", authHandlers.HandleResendVerification)
+	unauthorized.GET("auth/verify", authHandlers.HandleVerify)
+	unauthorized.POST("auth/forgotPassword", authHandlers.HandleForgotPassword)
+	unauthorized.POST("auth/resetPassword", authHandlers.HandleResetPassword)
+	unauthorized.GET("auth/oidc/login", authHandlers.HandleOidcLogin)
+	unauthorized.GET("auth/oidc/callback", authHandlers.HandleOidcCallback)
 	unauthorized.GET("images/:imageId", imageHandlers.HandleGetImageById)
+	unauthorized.GET(".well-known/jwks.json", authHandlers.HandleJwks)
 
 	docs.SwaggerInfo.BasePath = "/"
 	unauthorized.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -111,6 +282,20 @@ func main() {
 	r.Run(config.Config.AppHost)
 }
 
+func runCommand(command string, postersService *services.PostersService) error {
+	switch command {
+	case "backfill-posters":
+		processed, err := postersService.Backfill(context.Background())
+		if err != nil {
+			return err
+		}
+		log.Printf("Processed %d images", processed)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
 func connectToDb() (*pgxpool.Pool, error) {
 	conn, err := pgxpool.New(context.Background(), config.Config.DbConnectionString)
 	if err != nil {
@@ -140,6 +325,55 @@ func loadConfigs() error {
 	if err := viper.BindEnv("JWT_EXPIRE_DURATION"); err != nil {
 		viper.SetDefault("JWT_EXPIRE_DURATION", "24h")
 	}
+	viper.SetDefault("JWT_ALGORITHM", "RS256")
+	viper.SetDefault("JWT_KEY_ROTATION_INTERVAL", "720h")
+	viper.SetDefault("JWT_KEY_GRACE_PERIOD", "48h")
+	viper.SetDefault("IMAGES_SIGNED_URLS", false)
+	viper.SetDefault("IMAGES_SIGNING_KEY", "")
+	viper.SetDefault("IMAGES_URL_EXPIRE_DURATION", "1h")
+	viper.SetDefault("API_URL", "http://localhost:8081")
+	viper.SetDefault("MAILER", "log")
+	viper.SetDefault("MAILER_LOG_FILE", "")
+	viper.SetDefault("MAIL_FROM", "Ozinshe <noreply@ozinshe.local>")
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("VERIFICATION_TOKEN_EXPIRE_DURATION", "24h")
+	viper.SetDefault("PASSWORD_RESET_URL", "http://localhost:8080/resetPassword")
+	viper.SetDefault("PASSWORD_RESET_TOKEN_EXPIRE_DURATION", "1h")
+	viper.SetDefault("LOGIN_MAX_FAILURES", 5)
+	viper.SetDefault("LOGIN_LOCKOUT_DURATION", "15m")
+	viper.SetDefault("LOGIN_BACKOFF_BASE", "1s")
+	viper.SetDefault("LOGIN_BACKOFF_MAX", "5m")
+	viper.SetDefault("LOGIN_FAILURE_WINDOW", "1h")
+	viper.SetDefault("MAIL_RESEND_INTERVAL", "1m")
+	viper.SetDefault("MAIL_MAX_PER_IP_HOURLY", 20)
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("OIDC_ENABLED", false)
+	viper.SetDefault("OIDC_ISSUER_URL", "")
+	viper.SetDefault("OIDC_DISCOVERY_URL", "")
+	viper.SetDefault("OIDC_CLIENT_ID", "")
+	viper.SetDefault("OIDC_CLIENT_SECRET", "")
+	viper.SetDefault("OIDC_REDIRECT_URL", "http://localhost:8081/auth/oidc/callback")
+	viper.SetDefault("OIDC_SCOPES", "openid email profile")
+	viper.SetDefault("OIDC_ROLES_CLAIM", "groups")
+	viper.SetDefault("OIDC_ADMIN_ROLES", "")
+	viper.SetDefault("OIDC_EDITOR_ROLES", "")
+	viper.SetDefault("OIDC_DEMOTE_LOCAL_USERS", false)
+	viper.SetDefault("OIDC_POST_LOGIN_REDIRECT_URL", "http://localhost:8080/oidc")
+	viper.SetDefault("PASSWORD_MIN_LENGTH", 8)
+	viper.SetDefault("PASSWORD_BREACHED_LIST_FILE", "breached-passwords.txt")
+	viper.SetDefault("PASSWORD_HASH_ALGORITHM", "argon2id")
+	viper.SetDefault("PASSWORD_BCRYPT_COST", 10)
+	viper.SetDefault("PASSWORD_ARGON2_MEMORY", 19456)
+	viper.SetDefault("PASSWORD_ARGON2_ITERATIONS", 2)
+	viper.SetDefault("PASSWORD_ARGON2_PARALLELISM", 1)
+	viper.SetDefault("TWO_FACTOR_ISSUER", "Ozinshe")
+	viper.SetDefault("TWO_FACTOR_CHALLENGE_EXPIRE_DURATION", "5m")
+	viper.SetDefault("RECOMMENDATIONS_REFRESH_INTERVAL", "1h")
+	viper.SetDefault("RECOMMENDATIONS_NEIGHBOURS", 20)
+	viper.SetDefault("POPULARITY_REFRESH_INTERVAL", "15m")
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -152,6 +386,51 @@ func loadConfigs() error {
 		return err
 	}
 
+	trustedProxies := make([]string, 0, len(mapConfig.TrustedProxies))
+	for _, proxy := range mapConfig.TrustedProxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	mapConfig.TrustedProxies = trustedProxies
+
+	if mapConfig.ImagesSignedUrls && (mapConfig.ImagesSigningKey == "" || mapConfig.ImagesUrlExpiresIn <= 0) {
+		return fmt.Errorf("IMAGES_SIGNING_KEY and IMAGES_URL_EXPIRE_DURATION are required when IMAGES_SIGNED_URLS is enabled")
+	}
+
+	switch mapConfig.JwtAlgorithm {
+	case services.JwtAlgorithmHS256:
+	case services.JwtAlgorithmRS256, services.JwtAlgorithmEdDSA:
+		// Tokens signed with a retired key have to stay valid until they expire, and replicas which haven't
+		// noticed the rotation yet keep signing with it until their next check
+		if mapConfig.JwtKeyRotationInterval <= 0 || mapConfig.JwtKeyGracePeriod < mapConfig.JwtExpiresIn+services.SigningKeysCheckInterval {
+			return fmt.Errorf(
+				"JWT_KEY_ROTATION_INTERVAL must be positive and JWT_KEY_GRACE_PERIOD at least JWT_EXPIRE_DURATION plus %s",
+				services.SigningKeysCheckInterval,
+			)
+		}
+	default:
+		return fmt.Errorf("JWT_ALGORITHM must be one of HS256, RS256 or EdDSA")
+	}
+
+	if mapConfig.OidcEnabled && (mapConfig.OidcIssuerUrl == "" || mapConfig.OidcClientId == "" || mapConfig.OidcRedirectUrl == "") {
+		return fmt.Errorf("OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ENABLED is enabled")
+	}
+
+	switch mapConfig.PasswordHashAlgorithm {
+	case services.PasswordHashBcrypt:
+		if mapConfig.PasswordBcryptCost < bcrypt.MinCost || mapConfig.PasswordBcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case services.PasswordHashArgon2id:
+		if mapConfig.PasswordArgon2Memory <= 0 || mapConfig.PasswordArgon2Iterations <= 0 ||
+			mapConfig.PasswordArgon2Parallelism <= 0 || mapConfig.PasswordArgon2Parallelism > 255 {
+			return fmt.Errorf("PASSWORD_ARGON2_MEMORY, PASSWORD_ARGON2_ITERATIONS and PASSWORD_ARGON2_PARALLELISM must be positive")
+		}
+	default:
+		return fmt.Errorf("PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id")
+	}
+
 	config.Config = &mapConfig
 
 	return nil
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"time"
+)
+
+// AuditMiddleware lets handlers store audit events as soon as their change is made, whatever the request
+// ends up responding. The actor is taken from the request unless the handler already knows it, e.g. on sign up.
+func AuditMiddleware(auditRepo *repositories.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(models.AuditRecorderKey, models.AuditRecorder(func(event models.AuditEvent) error {
+			if event.ActorUserId == nil {
+				if userId, ok := c.Get("userId"); ok {
+					actorUserId := userId.(int)
+					event.ActorUserId = &actorUserId
+				}
+			}
+			if apiTokenId, ok := c.Get("apiTokenId"); ok {
+				actorApiToken := apiTokenId.(int)
+				event.ActorApiToken = &actorApiToken
+			}
+			event.Ip = c.ClientIP()
+			event.CreatedAt = time.Now()
+
+			return auditRepo.Create(c, event)
+		}))
+		c.Next()
+	}
+}
@@ -1,41 +1,105 @@
 package middlewares
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"log"
 	"net/http"
-	"ozinshe-final-project/config"
 	"ozinshe-final-project/models"
-	"strconv"
+	"ozinshe-final-project/repositories"
+	"ozinshe-final-project/services"
 	"strings"
+	"time"
 )
 
-func AuthMiddleware(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("Authorization header required"))
-		c.Abort()
-		return
+// touchInterval limits how often the last seen time of a session or an API token is written
+const touchInterval = time.Minute
+
+// AuthMiddleware accepts both access tokens of signed in sessions and personal API tokens.
+// The scopes of API tokens are checked separately by RequireScope.
+func AuthMiddleware(
+	jwtService *services.JwtService,
+	sessionsRepo *repositories.SessionsRepository,
+	apiTokensRepo *repositories.ApiTokensRepository,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, models.NewApiError("Authorization header required"))
+			c.Abort()
+			return
+		}
+
+		tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
+		if !found {
+			c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid token"))
+			c.Abort()
+			return
+		}
+
+		if strings.HasPrefix(tokenString, models.ApiTokenPrefix) {
+			authenticateApiToken(c, apiTokensRepo, tokenString)
+			return
+		}
+
+		claims, err := jwtService.ParseToken(c, tokenString, services.TokenTypeAccess)
+		if err != nil || claims.SessionId == "" {
+			c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid token"))
+			c.Abort()
+			return
+		}
+
+		userId := claims.UserId()
+
+		session, err := sessionsRepo.FindActive(c, userId, claims.SessionId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, models.NewApiError("Session has been revoked"))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			c.Abort()
+			return
+		}
+
+		err = sessionsRepo.Touch(c, session.Id, touchInterval)
+		if err != nil {
+			log.Printf("Failed to update session %s: %s", session.Id, err)
+		}
+
+		c.Set("userId", userId)
+		c.Set("sessionId", session.Id)
+		if claims.ProfileId != 0 {
+			c.Set("tokenProfileId", claims.ProfileId)
+		}
+		c.Next()
 	}
+}
 
-	tokenString := strings.Split(authHeader, "Bearer ")[1]
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.Config.JwtSecretKey), nil
-	})
-	if err != nil || !token.Valid {
+func authenticateApiToken(c *gin.Context, apiTokensRepo *repositories.ApiTokensRepository, tokenString string) {
+	token, err := apiTokensRepo.FindActiveByHash(c, services.HashSecureToken(tokenString))
+	if errors.Is(err, pgx.ErrNoRows) {
 		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid token"))
 		c.Abort()
 		return
 	}
-
-	subject, err := token.Claims.GetSubject()
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("Error while getting subject"))
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		c.Abort()
 		return
 	}
 
-	userId, _ := strconv.Atoi(subject)
-	c.Set("userId", userId)
+	err = apiTokensRepo.Touch(c, token.Id, touchInterval)
+	if err != nil {
+		log.Printf("Failed to update API token %d: %s", token.Id, err)
+	}
+
+	c.Set("userId", token.UserId)
+	c.Set("apiTokenId", token.Id)
+	c.Set("apiTokenScopes", token.Scopes)
+	// A token created in a kids profile must not fall back to the unrestricted default profile
+	c.Set("tokenProfileId", token.ProfileId)
 	c.Next()
 }
@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strconv"
+)
+
+// ProfileMiddleware resolves the active profile of the signed in user: the one in the X-Profile-Id header,
+// otherwise the one selected in the token, otherwise the default profile. It has to run after AuthMiddleware.
+// With parental controls on, the header can't switch to a profile which sees more than the selected one,
+// that needs the PIN when the profile is selected.
+func ProfileMiddleware(profilesRepo *repositories.ProfilesRepository, usersRepo *repositories.UsersRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.GetInt("userId")
+
+		profile, err := findSelectedProfile(c, profilesRepo, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			c.Abort()
+			return
+		}
+
+		if header := c.GetHeader(models.ProfileHeader); header != "" {
+			id, err := strconv.Atoi(header)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.NewApiError("Invalid profile id"))
+				c.Abort()
+				return
+			}
+
+			requested, err := profilesRepo.FindById(c, userId, id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusForbidden, models.NewApiError("Profile not found"))
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+				c.Abort()
+				return
+			}
+
+			if requested.AllowedAgeRating() > profile.AllowedAgeRating() {
+				pinHash, err := usersRepo.FindParentalPinHash(c, userId)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+					c.Abort()
+					return
+				}
+				if pinHash != "" {
+					c.JSON(http.StatusForbidden, models.NewApiError("Parental PIN required, select the profile instead"))
+					c.Abort()
+					return
+				}
+			}
+
+			profile = requested
+		}
+
+		c.Set("profile", profile)
+		c.Set("profileId", profile.Id)
+		c.Next()
+	}
+}
+
+// findSelectedProfile returns the profile selected in the token, falling back to the default one.
+func findSelectedProfile(c *gin.Context, profilesRepo *repositories.ProfilesRepository, userId int) (models.Profile, error) {
+	if id := c.GetInt("tokenProfileId"); id != 0 {
+		profile, err := profilesRepo.FindById(c, userId, id)
+		// The selected profile may have been deleted since the token was issued
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return profile, err
+		}
+	}
+
+	return profilesRepo.FindDefault(c, userId)
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"slices"
+	"strconv"
+)
+
+// RequireRole lets the request through only when the signed in user has one of the roles.
+// It has to run after AuthMiddleware.
+func RequireRole(usersRepo *repositories.UsersRepository, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, usersRepo, roles) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrRole additionally lets users through when the path parameter refers to themselves,
+// e.g. to change their own password.
+func RequireSelfOrRole(usersRepo *repositories.UsersRepository, param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param(param))
+		if err == nil && id == c.GetInt("userId") {
+			c.Next()
+			return
+		}
+
+		if !hasRole(c, usersRepo, roles) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func hasRole(c *gin.Context, usersRepo *repositories.UsersRepository, roles []string) bool {
+	user, err := usersRepo.FindById(c, c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		c.Abort()
+		return false
+	}
+
+	if !slices.Contains(roles, user.Role) {
+		c.JSON(http.StatusForbidden, models.NewApiError("Insufficient permissions"))
+		c.Abort()
+		return false
+	}
+
+	c.Set("userRole", user.Role)
+	return true
+}
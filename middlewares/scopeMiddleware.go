@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"ozinshe-final-project/models"
+	"slices"
+)
+
+// RequireScope rejects API tokens which were not granted the scope. Signed in sessions are
+// not limited by scopes, only by the role of the user.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isApiToken := c.Get("apiTokenId"); !isApiToken {
+			c.Next()
+			return
+		}
+
+		if !slices.Contains(c.GetStringSlice("apiTokenScopes"), scope) {
+			c.JSON(http.StatusForbidden, models.NewApiError(fmt.Sprintf("Token is missing the %s scope", scope)))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession keeps account management, e.g. creating more API tokens, available to signed in sessions only.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("sessionId") == "" {
+			c.JSON(http.StatusForbidden, models.NewApiError("Not available with an API token"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "slices"
+
+// AgeRatings are the certifications a movie can have, 0+ is suitable for everyone
+var AgeRatings = []int{0, 6, 12, 16, 18}
+
+// KidsMaxAgeRating is the highest age rating kids profiles can see whatever their own setting is
+const KidsMaxAgeRating = 6
+
+// Advisories describe why a movie got its age rating
+var Advisories = []string{
+	"violence",
+	"language",
+	"sex",
+	"nudity",
+	"drugs",
+	"alcohol",
+	"smoking",
+	"horror",
+	"discrimination",
+}
+
+func IsValidAgeRating(ageRating int) bool {
+	return slices.Contains(AgeRatings, ageRating)
+}
+
+func IsValidAdvisory(advisory string) bool {
+	return slices.Contains(Advisories, advisory)
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const ApiTokenPrefix = "oz_"
+
+const (
+	ScopeCatalogRead  = "catalog:read"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeLibraryRead  = "library:read"
+	ScopeLibraryWrite = "library:write"
+	ScopeUsersRead    = "users:read"
+	ScopeUsersWrite   = "users:write"
+	ScopeAuditRead    = "audit:read"
+)
+
+// ApiScopes lists every scope an API token can be granted. The library scopes cover the watchlist,
+// ratings and watched state of the token owner.
+var ApiScopes = []string{
+	ScopeCatalogRead,
+	ScopeCatalogWrite,
+	ScopeLibraryRead,
+	ScopeLibraryWrite,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeAuditRead,
+}
+
+// ApiToken is a long lived token for scripts acting on behalf of a user, only its hash is stored.
+type ApiToken struct {
+	Id         int
+	UserId     int
+	ProfileId  int
+	Name       string
+	TokenHash  string
+	Hint       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
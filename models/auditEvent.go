@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditRecorderKey is the request context key of the AuditRecorder set by AuditMiddleware
+const AuditRecorderKey = "auditRecorder"
+
+// AuditRecorder stores an audit event of the request right away
+type AuditRecorder func(event AuditEvent) error
+
+type AuditFilters struct {
+	ActorUserId int
+	EntityType  string
+	EntityId    string
+	Action      string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+	Offset      int
+}
+
+// AuditEvent records who changed what. Before and after are JSON snapshots of the entity,
+// either can be empty, e.g. when an entity is created or deleted.
+type AuditEvent struct {
+	Id            int64
+	ActorUserId   *int
+	ActorApiToken *int
+	Action        string
+	EntityType    string
+	EntityId      string
+	Before        json.RawMessage
+	After         json.RawMessage
+	Ip            string
+	CreatedAt     time.Time
+}
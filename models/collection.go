@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Collection is a shelf of movies put together by editors. CoverUrl holds the image id, MovieIds keep
+// the order set by the editor and Movies are the ones among them the profile can see.
+type Collection struct {
+	Id             int
+	Title          string
+	Description    string
+	CoverUrl       string
+	Position       int
+	PublishedFrom  *time.Time
+	PublishedUntil *time.Time
+	MovieIds       []int
+	Movies         []Movie
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// IsPublished tells whether the collection is shown at the moment, an open end of the window never closes it.
+func (c Collection) IsPublished(now time.Time) bool {
+	return (c.PublishedFrom == nil || !now.Before(*c.PublishedFrom)) &&
+		(c.PublishedUntil == nil || now.Before(*c.PublishedUntil))
+}
@@ -0,0 +1,45 @@
+package models
+
+const (
+	FranchiseOrderRelease       = "release"
+	FranchiseOrderChronological = "chronological"
+)
+
+func IsValidFranchiseOrder(order string) bool {
+	return order == FranchiseOrderRelease || order == FranchiseOrderChronological
+}
+
+// Franchise is a series of movies. Order is the one editors suggest to watch the movies in,
+// MovieIds follow the chronology of the story.
+type Franchise struct {
+	Id          int
+	Title       string
+	Description string
+	Order       string
+	MovieIds    []int
+	Entries     []FranchiseEntry
+	// Progress of the profile through the entries, NextMovieId is 0 once every entry is watched
+	WatchedCount int
+	NextMovieId  int
+}
+
+type FranchiseEntry struct {
+	MovieId               int
+	Title                 string
+	ReleaseYear           int
+	PosterUrl             string
+	IsWatched             bool
+	ReleasePosition       int
+	ChronologicalPosition int
+}
+
+// MovieFranchise places the movie within its franchise, Previous and Next follow the order of the franchise.
+type MovieFranchise struct {
+	Id       int
+	Title    string
+	Order    string
+	Position int
+	Count    int
+	Previous *FranchiseEntry
+	Next     *FranchiseEntry
+}
@@ -1,6 +1,11 @@
 package models
 
 type Genre struct {
-	Id    int
-	Title string
+	Id       int
+	Title    string
+	Slug     string
+	ParentId *int
+	Position int
+	// Children are only filled in when genres are returned as a tree
+	Children []Genre
 }
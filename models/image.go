@@ -0,0 +1,11 @@
+package models
+
+type Image struct {
+	Id            string
+	Hash          string
+	ContentType   string
+	Size          int64
+	RefCount      int
+	Blurhash      string
+	DominantColor string
+}
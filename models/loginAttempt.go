@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginAttempt counts the failed attempts to sign in to an account or from a client IP.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
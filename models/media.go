@@ -0,0 +1,35 @@
+package models
+
+const (
+	MediaTypePoster   = "poster"
+	MediaTypeBackdrop = "backdrop"
+	MediaTypeStill    = "still"
+	MediaTypeTrailer  = "trailer"
+	MediaTypeTeaser   = "teaser"
+)
+
+// MovieMedia is an item of the movie gallery. Url holds the image id for images
+// and the normalised video link for trailers and teasers.
+type MovieMedia struct {
+	Id            int
+	MovieId       int
+	Type          string
+	Url           string
+	Language      string
+	Position      int
+	IsPrimary     bool
+	Blurhash      string
+	DominantColor string
+	Provider      string
+	VideoId       string
+	EmbedUrl      string
+	ThumbnailUrl  string
+}
+
+func IsImageMediaType(mediaType string) bool {
+	return mediaType == MediaTypePoster || mediaType == MediaTypeBackdrop || mediaType == MediaTypeStill
+}
+
+func IsVideoMediaType(mediaType string) bool {
+	return mediaType == MediaTypeTrailer || mediaType == MediaTypeTeaser
+}
@@ -5,17 +5,36 @@ type MovieFilters struct {
 	GenreIds   []string
 	IsWatched  string
 	Sort       string
+	// IncludeSubgenres also matches the movies of the subgenres of GenreIds
+	IncludeSubgenres bool
+	// TagIds narrow the movies down to the ones with every tag
+	TagIds []int
+	// PopularityWindow is the window the popularity is read for, a month when empty
+	PopularityWindow string
 }
 
 type Movie struct {
-	Id          int
-	Title       string
-	Description string
-	ReleaseYear int
-	Director    string
-	Rating      int
-	TrailerUrl  string
-	PosterUrl   string
-	IsWatched   bool
-	Genres      []Genre
+	Id                  int
+	Title               string
+	Description         string
+	ReleaseYear         int
+	Director            string
+	Rating              int
+	TrailerUrl          string
+	TrailerProvider     string
+	TrailerVideoId      string
+	TrailerEmbedUrl     string
+	TrailerThumbnailUrl string
+	PosterUrl           string
+	PosterBlurhash      string
+	PosterColor         string
+	IsWatched           bool
+	AgeRating           int
+	Advisories          []string
+	ReviewsCount        int
+	Popularity          float64
+	Genres              []Genre
+	Tags                []Tag
+	// Franchise is only filled in when a single movie is requested
+	Franchise *MovieFranchise
 }
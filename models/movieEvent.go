@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	MovieEventView      = "view"
+	MovieEventWatch     = "watch"
+	MovieEventRating    = "rating"
+	MovieEventWatchlist = "watchlist"
+)
+
+// MovieEventWeights is how much each kind of event adds to the popularity of the movie
+var MovieEventWeights = map[string]float64{
+	MovieEventView:      1,
+	MovieEventWatch:     3,
+	MovieEventRating:    2,
+	MovieEventWatchlist: 2,
+}
+
+type MovieEvent struct {
+	MovieId   int
+	ProfileId int
+	Type      string
+	CreatedAt time.Time
+}
+
+// PopularityWindow is the period popularity is counted over, events lose half of their weight every half-life
+type PopularityWindow struct {
+	Name     string
+	Duration time.Duration
+	HalfLife time.Duration
+}
+
+// PopularityWindowMonth is the window sort=popularity and the popularity of a movie refer to
+const PopularityWindowMonth = "month"
+
+var PopularityWindows = []PopularityWindow{
+	{Name: "day", Duration: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "week", Duration: 7 * 24 * time.Hour, HalfLife: 2 * 24 * time.Hour},
+	{Name: PopularityWindowMonth, Duration: 30 * 24 * time.Hour, HalfLife: 7 * 24 * time.Hour},
+}
+
+func IsValidPopularityWindow(name string) bool {
+	return slices.ContainsFunc(PopularityWindows, func(window PopularityWindow) bool {
+		return window.Name == name
+	})
+}
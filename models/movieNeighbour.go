@@ -0,0 +1,14 @@
+package models
+
+type MovieRating struct {
+	ProfileId int
+	MovieId   int
+	Rating    int
+}
+
+// MovieNeighbour is a movie rated alike by the profiles which rated the movie, the higher the score the closer
+type MovieNeighbour struct {
+	MovieId     int
+	NeighbourId int
+	Score       float64
+}
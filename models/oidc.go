@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OidcLoginState is kept between redirecting the user to the identity provider and the callback.
+// Only the hash of the state parameter is stored.
+type OidcLoginState struct {
+	StateHash    string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	Issuer  string
+	Subject string
+	UserId  int
+	Email   string
+	// Provisioned is true when the user was created by signing in through the identity
+	Provisioned bool
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// MaxProfilesPerUser limits how many viewer profiles one account can have
+const MaxProfilesPerUser = 5
+
+// ProfileHeader selects the active profile of a request, it takes precedence over the pid claim of the token
+const ProfileHeader = "X-Profile-Id"
+
+// Profile is a viewer sharing the account, ratings, watched movies and the watchlist belong to the profile.
+// Every user has a default profile which is used when no other profile is selected.
+type Profile struct {
+	Id       int
+	UserId   int
+	Name     string
+	Avatar   string
+	Language string
+	IsKids   bool
+	// MaxAgeRating is the highest age rating of movies the profile sees, changing it needs the parental PIN
+	MaxAgeRating int
+	IsDefault    bool
+	CreatedAt    time.Time
+}
+
+// AllowedAgeRating is the highest age rating the profile can see, kids profiles are capped at KidsMaxAgeRating.
+func (p Profile) AllowedAgeRating() int {
+	if p.IsKids {
+		return min(p.MaxAgeRating, KidsMaxAgeRating)
+	}
+	return p.MaxAgeRating
+}
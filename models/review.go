@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	// ReviewStatusPending reviews wait in the moderation queue, only their authors see them
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusHidden   = "hidden"
+)
+
+// Review is written by a viewer profile, one per movie. Editing a review sends it back to moderation.
+type Review struct {
+	Id         int
+	MovieId    int
+	UserId     int
+	ProfileId  int
+	AuthorName string
+	Text       string
+	IsSpoiler  bool
+	// Rating is the author's own rating of the movie, from 1 to 5
+	Rating     int
+	Status     string
+	LikesCount int
+	// ReportsCount counts the reports made since the review was last moderated
+	ReportsCount int
+	IsLiked      bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type ReviewReport struct {
+	ReviewId  int
+	ProfileId int
+	Reason    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is a signed in device, every access token belongs to one.
+type Session struct {
+	Id         string
+	UserId     int
+	UserAgent  string
+	Ip         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SigningKey is a key pair used to sign access tokens, both halves are stored PEM encoded.
+// A retired key no longer signs tokens but still verifies them until it expires.
+type SigningKey struct {
+	Id         string
+	Algorithm  string
+	PrivateKey string
+	PublicKey  string
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+	ExpiresAt  *time.Time
+}
@@ -0,0 +1,6 @@
+package models
+
+type Tag struct {
+	Id    int
+	Title string
+}
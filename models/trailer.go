@@ -0,0 +1,14 @@
+package models
+
+const (
+	TrailerProviderYoutube = "youtube"
+	TrailerProviderVimeo   = "vimeo"
+	TrailerProviderMp4     = "mp4"
+)
+
+// Trailer is a normalised video link. VideoId is empty for direct files.
+type Trailer struct {
+	Provider string
+	VideoId  string
+	Url      string
+}
@@ -0,0 +1,10 @@
+package models
+
+// TwoFactor holds the TOTP settings of a user. The secret is kept while the enrolment is pending
+// confirmation, the second factor is only required once it's enabled.
+type TwoFactor struct {
+	UserId       int
+	Secret       string
+	IsEnabled    bool
+	LastUsedStep int64
+}
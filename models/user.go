@@ -1,8 +1,28 @@
 package models
 
+const (
+	RoleUser   = "user"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
 type User struct {
 	Id           int
 	Name         string
 	Email        string
 	PasswordHash string
+	IsVerified   bool
+	Role         string
+}
+
+// roleRanks orders the roles by what they allow
+var roleRanks = map[string]int{RoleUser: 0, RoleEditor: 1, RoleAdmin: 2}
+
+// IsHigherRole tells whether the role allows more than the other one.
+func IsHigherRole(role string, other string) bool {
+	return roleRanks[role] > roleRanks[other]
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleEditor || role == RoleAdmin
 }
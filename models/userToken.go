@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+const (
+	UserTokenPurposeVerification  = "verification"
+	UserTokenPurposePasswordReset = "password_reset"
+)
+
+// UserToken is a single-use token sent to the user by email, only its hash is stored.
+type UserToken struct {
+	Id        int
+	UserId    int
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// withTryAdvisoryLock runs fn in a transaction holding the advisory lock key, so that replicas
+// sharing the database don't do the same work at once. Nothing is done when another replica holds
+// the lock at the moment, in which case false is returned.
+func withTryAdvisoryLock(c context.Context, db *pgxpool.Pool, key int64, fn func(tx pgx.Tx) error) (bool, error) {
+	tx, err := db.Begin(c)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(c)
+
+	var locked bool
+	err = tx.QueryRow(c, "select pg_try_advisory_xact_lock($1)", key).Scan(&locked)
+	if err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(c)
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type ApiTokensRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewApiTokensRepository(db *pgxpool.Pool) *ApiTokensRepository {
+	return &ApiTokensRepository{db: db}
+}
+
+const apiTokenSelect = `
+select id, user_id, profile_id, name, token_hash, hint, scopes, created_at, expires_at, last_used_at
+from api_tokens
+`
+
+func (r *ApiTokensRepository) Create(c context.Context, token models.ApiToken) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		c,
+		`
+insert into api_tokens(user_id, profile_id, name, token_hash, hint, scopes, created_at, expires_at)
+values($1, $2, $3, $4, $5, $6, $7, $8)
+returning id`,
+		token.UserId,
+		token.ProfileId,
+		token.Name,
+		token.TokenHash,
+		token.Hint,
+		token.Scopes,
+		token.CreatedAt,
+		token.ExpiresAt,
+	).Scan(&id)
+
+	return id, err
+}
+
+// FindActiveByHash returns the token unless it was revoked or has expired, pgx.ErrNoRows otherwise.
+func (r *ApiTokensRepository) FindActiveByHash(c context.Context, tokenHash string) (models.ApiToken, error) {
+	sql := apiTokenSelect + "where token_hash = $1 and revoked_at is null and (expires_at is null or expires_at > $2)"
+	return scanApiToken(r.db.QueryRow(c, sql, tokenHash, time.Now()))
+}
+
+func (r *ApiTokensRepository) FindAllActive(c context.Context, userId int) ([]models.ApiToken, error) {
+	sql := apiTokenSelect + "where user_id = $1 and revoked_at is null and (expires_at is null or expires_at > $2) order by created_at desc"
+	rows, err := r.db.Query(c, sql, userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]models.ApiToken, 0)
+	for rows.Next() {
+		token, err := scanApiToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Touch updates the last used time, but at most once per interval to avoid a write on every request.
+func (r *ApiTokensRepository) Touch(c context.Context, id int, interval time.Duration) error {
+	now := time.Now()
+	_, err := r.db.Exec(
+		c,
+		"update api_tokens set last_used_at = $1 where id = $2 and (last_used_at is null or last_used_at < $3)",
+		now,
+		id,
+		now.Add(-interval),
+	)
+
+	return err
+}
+
+// Revoke returns false when the user has no active token with the id.
+func (r *ApiTokensRepository) Revoke(c context.Context, userId int, id int) (bool, error) {
+	tag, err := r.db.Exec(
+		c,
+		"update api_tokens set revoked_at = $1 where id = $2 and user_id = $3 and revoked_at is null",
+		time.Now(),
+		id,
+		userId,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func scanApiToken(row pgx.Row) (models.ApiToken, error) {
+	var token models.ApiToken
+	err := row.Scan(&token.Id, &token.UserId, &token.ProfileId, &token.Name, &token.TokenHash, &token.Hint, &token.Scopes,
+		&token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt)
+
+	return token, err
+}
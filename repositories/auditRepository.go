@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type AuditRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(c context.Context, event models.AuditEvent) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into audit_events(actor_user_id, actor_api_token_id, action, entity_type, entity_id, before, after, ip, created_at)
+values($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.ActorUserId,
+		event.ActorApiToken,
+		event.Action,
+		event.EntityType,
+		event.EntityId,
+		nullableJson(event.Before),
+		nullableJson(event.After),
+		event.Ip,
+		event.CreatedAt,
+	)
+
+	return err
+}
+
+// FindAll returns the matching events, the newest first. From and to are inclusive.
+func (r *AuditRepository) FindAll(c context.Context, filters models.AuditFilters) ([]models.AuditEvent, error) {
+	sql := `
+select id, actor_user_id, actor_api_token_id, action, entity_type, entity_id,
+       coalesce(before, 'null'::jsonb), coalesce(after, 'null'::jsonb), ip, created_at
+from audit_events
+where 1 = 1`
+
+	params := pgx.NamedArgs{}
+	if filters.ActorUserId != 0 {
+		sql = fmt.Sprintf("%s and actor_user_id = @actorUserId", sql)
+		params["actorUserId"] = filters.ActorUserId
+	}
+	if filters.EntityType != "" {
+		sql = fmt.Sprintf("%s and entity_type = @entityType", sql)
+		params["entityType"] = filters.EntityType
+	}
+	if filters.EntityId != "" {
+		sql = fmt.Sprintf("%s and entity_id = @entityId", sql)
+		params["entityId"] = filters.EntityId
+	}
+	if filters.Action != "" {
+		sql = fmt.Sprintf("%s and action = @action", sql)
+		params["action"] = filters.Action
+	}
+	if filters.From != nil {
+		sql = fmt.Sprintf("%s and created_at >= @from", sql)
+		params["from"] = *filters.From
+	}
+	if filters.To != nil {
+		sql = fmt.Sprintf("%s and created_at <= @to", sql)
+		params["to"] = *filters.To
+	}
+
+	sql = fmt.Sprintf("%s order by created_at desc, id desc limit @limit offset @offset", sql)
+	params["limit"] = filters.Limit
+	params["offset"] = filters.Offset
+
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.AuditEvent, 0)
+	for rows.Next() {
+		var event models.AuditEvent
+		err := rows.Scan(&event.Id, &event.ActorUserId, &event.ActorApiToken, &event.Action, &event.EntityType, &event.EntityId,
+			&event.Before, &event.After, &event.Ip, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func nullableJson(value []byte) any {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
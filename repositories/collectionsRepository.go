@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type CollectionsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewCollectionsRepository(db *pgxpool.Pool) *CollectionsRepository {
+	return &CollectionsRepository{db: db}
+}
+
+const collectionSelect = `
+select c.id,
+       c.title,
+       c.description,
+       c.cover_id,
+       c.position,
+       c.published_from,
+       c.published_until,
+       coalesce(array_agg(cm.movie_id order by cm.position) filter (where cm.movie_id is not null), '{}'),
+       c.created_at,
+       c.updated_at
+from collections c
+left join collection_movies cm on cm.collection_id = c.id
+`
+
+// FindAll returns the collections in the order of the home screen. With publishedAt only the ones
+// published at that moment are returned.
+func (r *CollectionsRepository) FindAll(c context.Context, publishedAt *time.Time) ([]models.Collection, error) {
+	sql := fmt.Sprintf("%s where 1 = 1", collectionSelect)
+	params := pgx.NamedArgs{}
+	if publishedAt != nil {
+		sql = fmt.Sprintf("%s and (c.published_from is null or c.published_from <= @now) and (c.published_until is null or c.published_until > @now)", sql)
+		params["now"] = *publishedAt
+	}
+	sql = fmt.Sprintf("%s group by c.id order by c.position, c.id", sql)
+
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]models.Collection, 0)
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+func (r *CollectionsRepository) FindById(c context.Context, id int) (models.Collection, error) {
+	return scanCollection(r.db.QueryRow(c, collectionSelect+"where c.id = $1 group by c.id", id))
+}
+
+func (r *CollectionsRepository) Create(c context.Context, collection models.Collection) (int, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(c)
+
+	var id int
+	err = tx.QueryRow(
+		c,
+		`
+insert into collections(title, description, cover_id, position, published_from, published_until, created_at, updated_at)
+values($1, $2, $3, $4, $5, $6, $7, $7)
+returning id`,
+		collection.Title,
+		collection.Description,
+		collection.CoverUrl,
+		collection.Position,
+		collection.PublishedFrom,
+		collection.PublishedUntil,
+		collection.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertCollectionMovies(c, tx, id, collection.MovieIds)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(c)
+}
+
+func (r *CollectionsRepository) Update(c context.Context, collection models.Collection) error {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(
+		c,
+		`
+update collections
+set title = $1,
+    description = $2,
+    cover_id = $3,
+    position = $4,
+    published_from = $5,
+    published_until = $6,
+    updated_at = $7
+where id = $8`,
+		collection.Title,
+		collection.Description,
+		collection.CoverUrl,
+		collection.Position,
+		collection.PublishedFrom,
+		collection.PublishedUntil,
+		collection.UpdatedAt,
+		collection.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "delete from collection_movies where collection_id = $1", collection.Id)
+	if err != nil {
+		return err
+	}
+
+	err = insertCollectionMovies(c, tx, collection.Id, collection.MovieIds)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(c)
+}
+
+func (r *CollectionsRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from collections where id = $1", id)
+	return err
+}
+
+func insertCollectionMovies(c context.Context, tx pgx.Tx, collectionId int, movieIds []int) error {
+	for position, movieId := range movieIds {
+		_, err := tx.Exec(
+			c,
+			"insert into collection_movies(collection_id, movie_id, position) values($1, $2, $3)",
+			collectionId,
+			movieId,
+			position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanCollection(row pgx.Row) (models.Collection, error) {
+	var collection models.Collection
+	err := row.Scan(
+		&collection.Id,
+		&collection.Title,
+		&collection.Description,
+		&collection.CoverUrl,
+		&collection.Position,
+		&collection.PublishedFrom,
+		&collection.PublishedUntil,
+		&collection.MovieIds,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+	)
+
+	return collection, err
+}
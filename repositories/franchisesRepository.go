@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type FranchisesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewFranchisesRepository(db *pgxpool.Pool) *FranchisesRepository {
+	return &FranchisesRepository{db: db}
+}
+
+const franchiseSelect = `
+select f.id,
+       f.title,
+       f.description,
+       f.watch_order,
+       coalesce(array_agg(fm.movie_id order by fm.position) filter (where fm.movie_id is not null), '{}')
+from franchises f
+left join franchise_movies fm on fm.franchise_id = f.id
+`
+
+func (r *FranchisesRepository) FindAll(c context.Context) ([]models.Franchise, error) {
+	rows, err := r.db.Query(c, franchiseSelect+"group by f.id order by f.title")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	franchises := make([]models.Franchise, 0)
+	for rows.Next() {
+		franchise, err := scanFranchise(rows)
+		if err != nil {
+			return nil, err
+		}
+		franchises = append(franchises, franchise)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return franchises, nil
+}
+
+func (r *FranchisesRepository) FindById(c context.Context, id int) (models.Franchise, error) {
+	return scanFranchise(r.db.QueryRow(c, franchiseSelect+"where f.id = $1 group by f.id", id))
+}
+
+// FindByMovie returns the franchise the movie belongs to, pgx.ErrNoRows if it's not part of any.
+func (r *FranchisesRepository) FindByMovie(c context.Context, movieId int) (models.Franchise, error) {
+	sql := franchiseSelect + "where f.id = (select franchise_id from franchise_movies where movie_id = $1) group by f.id"
+	return scanFranchise(r.db.QueryRow(c, sql, movieId))
+}
+
+// FindEntries returns the movies of the franchise the profile can see, with its watched state,
+// in the chronology of the story.
+func (r *FranchisesRepository) FindEntries(c context.Context, id int, profile *models.Profile) ([]models.FranchiseEntry, error) {
+	sql := `
+select m.id,
+       m.title,
+       m.release_year,
+       m.poster_id,
+       coalesce(pm.is_watched, false)
+from franchise_movies fm
+join movies m on m.id = fm.movie_id
+left join profile_movies pm on pm.movie_id = m.id and pm.profile_id = @profileId
+where fm.franchise_id = @id`
+
+	params := pgx.NamedArgs{"id": id}
+	sql = restrictToProfile(sql, params, profile)
+	sql = fmt.Sprintf("%s order by fm.position", sql)
+
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.FranchiseEntry, 0)
+	for rows.Next() {
+		var entry models.FranchiseEntry
+		err := rows.Scan(&entry.MovieId, &entry.Title, &entry.ReleaseYear, &entry.PosterUrl, &entry.IsWatched)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *FranchisesRepository) Create(c context.Context, franchise models.Franchise) (int, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(c)
+
+	var id int
+	err = tx.QueryRow(
+		c,
+		"insert into franchises(title, description, watch_order) values($1, $2, $3) returning id",
+		franchise.Title,
+		franchise.Description,
+		franchise.Order,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertFranchiseMovies(c, tx, id, franchise.MovieIds)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(c)
+}
+
+func (r *FranchisesRepository) Update(c context.Context, franchise models.Franchise) error {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(
+		c,
+		"update franchises set title = $1, description = $2, watch_order = $3 where id = $4",
+		franchise.Title,
+		franchise.Description,
+		franchise.Order,
+		franchise.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "delete from franchise_movies where franchise_id = $1", franchise.Id)
+	if err != nil {
+		return err
+	}
+
+	err = insertFranchiseMovies(c, tx, franchise.Id, franchise.MovieIds)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(c)
+}
+
+func (r *FranchisesRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from franchises where id = $1", id)
+	return err
+}
+
+func insertFranchiseMovies(c context.Context, tx pgx.Tx, franchiseId int, movieIds []int) error {
+	for position, movieId := range movieIds {
+		_, err := tx.Exec(
+			c,
+			"insert into franchise_movies(franchise_id, movie_id, position) values($1, $2, $3)",
+			franchiseId,
+			movieId,
+			position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanFranchise(row pgx.Row) (models.Franchise, error) {
+	var franchise models.Franchise
+	err := row.Scan(&franchise.Id, &franchise.Title, &franchise.Description, &franchise.Order, &franchise.MovieIds)
+
+	return franchise, err
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"ozinshe-final-project/models"
 )
@@ -14,8 +15,10 @@ func NewGenresRepository(db *pgxpool.Pool) *GenresRepository {
 	return &GenresRepository{db: db}
 }
 
+const genreSelect = "select id, title, slug, parent_id, position from genres"
+
 func (r *GenresRepository) FindAll(c context.Context) ([]models.Genre, error) {
-	rows, err := r.db.Query(c, "select id, title from genres")
+	rows, err := r.db.Query(c, genreSelect+" order by position, title")
 	if err != nil {
 		return nil, err
 	}
@@ -23,8 +26,8 @@ func (r *GenresRepository) FindAll(c context.Context) ([]models.Genre, error) {
 
 	genres := make([]models.Genre, 0)
 	for rows.Next() {
-		var genre models.Genre
-		if err := rows.Scan(&genre.Id, &genre.Title); err != nil {
+		genre, err := scanGenre(rows)
+		if err != nil {
 			return nil, err
 		}
 		genres = append(genres, genre)
@@ -37,18 +40,23 @@ func (r *GenresRepository) FindAll(c context.Context) ([]models.Genre, error) {
 }
 
 func (r *GenresRepository) FindById(c context.Context, id int) (models.Genre, error) {
-	var genre models.Genre
-	err := r.db.QueryRow(c, "select id, title from genres where id = $1", id).Scan(&genre.Id, &genre.Title)
-	if err != nil {
-		return models.Genre{}, err
-	}
+	return scanGenre(r.db.QueryRow(c, genreSelect+" where id = $1", id))
+}
 
-	return genre, nil
+func (r *GenresRepository) FindBySlug(c context.Context, slug string) (models.Genre, error) {
+	return scanGenre(r.db.QueryRow(c, genreSelect+" where slug = $1", slug))
 }
 
 func (r *GenresRepository) Create(c context.Context, genre models.Genre) (int, error) {
 	var id int
-	err := r.db.QueryRow(c, "insert into genres(title) values($1) returning id", genre.Title).Scan(&id)
+	err := r.db.QueryRow(
+		c,
+		"insert into genres(title, slug, parent_id, position) values($1, $2, $3, $4) returning id",
+		genre.Title,
+		genre.Slug,
+		genre.ParentId,
+		genre.Position,
+	).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -56,11 +64,42 @@ func (r *GenresRepository) Create(c context.Context, genre models.Genre) (int, e
 }
 
 func (r *GenresRepository) Update(c context.Context, id int, genre models.Genre) error {
-	_, err := r.db.Exec(c, "update genres set title = $1 where id = $2", genre.Title, id)
+	_, err := r.db.Exec(
+		c,
+		"update genres set title = $1, slug = $2, parent_id = $3, position = $4 where id = $5",
+		genre.Title,
+		genre.Slug,
+		genre.ParentId,
+		genre.Position,
+		id,
+	)
 	return err
 }
 
+// Delete removes the genre, its subgenres move up to its parent.
 func (r *GenresRepository) Delete(c context.Context, id int) error {
-	_, err := r.db.Exec(c, "delete from genres where id = $1", id)
-	return err
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(c, "update genres set parent_id = (select parent_id from genres where id = $1) where parent_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "delete from genres where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(c)
+}
+
+func scanGenre(row pgx.Row) (models.Genre, error) {
+	var genre models.Genre
+	err := row.Scan(&genre.Id, &genre.Title, &genre.Slug, &genre.ParentId, &genre.Position)
+
+	return genre, err
 }
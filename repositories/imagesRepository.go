@@ -0,0 +1,208 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type ImagesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewImagesRepository(db *pgxpool.Pool) *ImagesRepository {
+	return &ImagesRepository{db: db}
+}
+
+func (r *ImagesRepository) FindById(c context.Context, id string) (models.Image, error) {
+	var image models.Image
+	err := r.db.QueryRow(c, "select id, hash, content_type, size, ref_count, blurhash, dominant_color from images where id = $1", id).
+		Scan(&image.Id, &image.Hash, &image.ContentType, &image.Size, &image.RefCount, &image.Blurhash, &image.DominantColor)
+
+	return image, err
+}
+
+func (r *ImagesRepository) FindByHash(c context.Context, hash string) (models.Image, error) {
+	var image models.Image
+	err := r.db.QueryRow(c, "select id, hash, content_type, size, ref_count, blurhash, dominant_color from images where hash = $1", hash).
+		Scan(&image.Id, &image.Hash, &image.ContentType, &image.Size, &image.RefCount, &image.Blurhash, &image.DominantColor)
+
+	return image, err
+}
+
+// AddReference registers one more usage of the image, creating the record if the content is new.
+// The id of the stored image is returned, which may differ from image.Id when the same content
+// has been uploaded before under a different name. The file is stored under that id while the record
+// is locked, so it can't be removed by a concurrent RemoveReference before the reference is committed.
+func (r *ImagesRepository) AddReference(c context.Context, image models.Image, store func(id string) error) (string, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(c)
+
+	var id string
+	err = tx.QueryRow(
+		c,
+		`
+insert into images(id, hash, content_type, size, ref_count, blurhash, dominant_color)
+values($1, $2, $3, $4, 1, $5, $6)
+on conflict (hash) do update set ref_count = images.ref_count + 1
+returning id`,
+		image.Id,
+		image.Hash,
+		image.ContentType,
+		image.Size,
+		image.Blurhash,
+		image.DominantColor,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	err = store(id)
+	if err != nil {
+		return "", err
+	}
+
+	return id, tx.Commit(c)
+}
+
+// Retain registers one more usage of an image which is already stored and reports whether it was found.
+func (r *ImagesRepository) Retain(c context.Context, id string) (bool, error) {
+	tag, err := r.db.Exec(c, "update images set ref_count = ref_count + 1 where id = $1", id)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// RemoveReference releases one usage of the image and reports whether the record was removed
+// because nothing refers to it anymore, in which case remove is called to delete the file before
+// the record lock is released. Images unknown to the table are never removed.
+func (r *ImagesRepository) RemoveReference(c context.Context, id string, remove func() error) (bool, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(c)
+
+	// The row stays locked until the commit, so a concurrent upload of the same content waits
+	// and either revives the image before it is deleted or inserts it and its file anew after
+	var refCount int
+	err = tx.QueryRow(c, "update images set ref_count = ref_count - 1 where id = $1 and ref_count > 0 returning ref_count", id).
+		Scan(&refCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if refCount > 0 {
+		return false, tx.Commit(c)
+	}
+
+	tag, err := tx.Exec(c, "delete from images where id = $1 and ref_count = 0", id)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, tx.Commit(c)
+	}
+
+	err = remove()
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(c)
+}
+
+// Upsert stores the metadata of an image found on disk. Images which were not tracked before
+// get their references counted from the movies, galleries and collections using them. When the same
+// content is already stored under another id, the references are moved over to that image and its id
+// is returned, so the duplicate file can be removed.
+func (r *ImagesRepository) Upsert(c context.Context, image models.Image) (string, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(c)
+
+	var existingId string
+	err = tx.QueryRow(c, "select id from images where hash = $1 for update", image.Hash).Scan(&existingId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	if existingId != "" && existingId != image.Id {
+		err = mergeImage(c, tx, image.Id, existingId)
+		if err != nil {
+			return "", err
+		}
+
+		return existingId, tx.Commit(c)
+	}
+
+	_, err = tx.Exec(
+		c,
+		`
+insert into images(id, hash, content_type, size, ref_count, blurhash, dominant_color)
+values($1, $2, $3, $4, `+countImageReferences+`, $5, $6)
+on conflict (id) do update
+set hash = excluded.hash,
+    content_type = excluded.content_type,
+    size = excluded.size,
+    blurhash = excluded.blurhash,
+    dominant_color = excluded.dominant_color`,
+		image.Id,
+		image.Hash,
+		image.ContentType,
+		image.Size,
+		image.Blurhash,
+		image.DominantColor,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return image.Id, tx.Commit(c)
+}
+
+// countImageReferences counts the usages of the image with the id $1 which was stored before uploads were tracked
+const countImageReferences = `(select count(*) from movies where poster_id = $1) +
+       (select count(*) from movie_media where url = $1) +
+       (select count(*) from collections where cover_id = $1)`
+
+// mergeImage points everything using the image duplicateId to the image id instead and adds its references to it.
+func mergeImage(c context.Context, tx pgx.Tx, duplicateId string, id string) error {
+	var refCount int
+	err := tx.QueryRow(c, "delete from images where id = $1 returning ref_count", duplicateId).Scan(&refCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(c, "select "+countImageReferences, duplicateId).Scan(&refCount)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "update images set ref_count = ref_count + $2 where id = $1", id, refCount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "update movies set poster_id = $2 where poster_id = $1", duplicateId, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "update movie_media set url = $2 where url = $1", duplicateId, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(c, "update collections set cover_id = $2 where cover_id = $1", duplicateId, id)
+	return err
+}
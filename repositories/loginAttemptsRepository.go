@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type LoginAttemptsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginAttemptsRepository(db *pgxpool.Pool) *LoginAttemptsRepository {
+	return &LoginAttemptsRepository{db: db}
+}
+
+// Reserve locks the counters of the keys and, unless any of them is blocked at the moment, replaces
+// them with the ones returned by next. The counters are returned as they were before, together with
+// whether the attempt was reserved. Parallel attempts wait for each other, so every one of them sees
+// the counters left by the previous one.
+func (r *LoginAttemptsRepository) Reserve(
+	c context.Context,
+	keys []string,
+	now time.Time,
+	next func(attempt models.LoginAttempt) models.LoginAttempt,
+) ([]models.LoginAttempt, bool, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(
+		c,
+		`
+insert into login_attempts(key, failures, last_failure_at, blocked_until)
+select key, 0, $2, $2
+from unnest($1::text[]) as key
+on conflict (key) do nothing`,
+		keys,
+		now,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Locked in the order of the keys so that attempts sharing a key can't deadlock
+	rows, err := tx.Query(
+		c,
+		"select key, failures, last_failure_at, blocked_until from login_attempts where key = any($1) order by key for update",
+		keys,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	attempts := make([]models.LoginAttempt, 0, len(keys))
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		err = rows.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.BlockedUntil)
+		if err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	for _, attempt := range attempts {
+		if attempt.BlockedUntil.After(now) {
+			return attempts, false, nil
+		}
+	}
+
+	for _, attempt := range attempts {
+		err = updateLoginAttempt(c, tx, next(attempt))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return attempts, true, tx.Commit(c)
+}
+
+// Restore puts the counters back as they were before a reservation, unless another attempt has
+// changed them since, i.e. they are no longer blocked until reservedUntil.
+func (r *LoginAttemptsRepository) Restore(c context.Context, attempt models.LoginAttempt, reservedUntil time.Time) error {
+	_, err := r.db.Exec(
+		c,
+		"update login_attempts set failures = $2, last_failure_at = $3, blocked_until = $4 where key = $1 and blocked_until = $5",
+		attempt.Key,
+		attempt.Failures,
+		attempt.LastFailureAt,
+		attempt.BlockedUntil,
+		reservedUntil,
+	)
+	return err
+}
+
+func (r *LoginAttemptsRepository) Delete(c context.Context, key string) error {
+	_, err := r.db.Exec(c, "delete from login_attempts where key = $1", key)
+	return err
+}
+
+// DeleteExpired removes the counters which are no longer blocked and whose last failure happened before
+// forgottenBefore, the next attempt would start counting from zero for them anyway.
+func (r *LoginAttemptsRepository) DeleteExpired(c context.Context, now time.Time, forgottenBefore time.Time) error {
+	_, err := r.db.Exec(c, "delete from login_attempts where blocked_until <= $1 and last_failure_at < $2", now, forgottenBefore)
+	return err
+}
+
+func updateLoginAttempt(c context.Context, tx pgx.Tx, attempt models.LoginAttempt) error {
+	_, err := tx.Exec(
+		c,
+		"update login_attempts set failures = $2, last_failure_at = $3, blocked_until = $4 where key = $1",
+		attempt.Key,
+		attempt.Failures,
+		attempt.LastFailureAt,
+		attempt.BlockedUntil,
+	)
+	return err
+}
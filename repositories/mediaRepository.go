@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type MediaRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMediaRepository(db *pgxpool.Pool) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+const mediaSelect = `
+select mm.id,
+       mm.movie_id,
+       mm.type,
+       mm.url,
+       mm.language,
+       mm.position,
+       mm.is_primary,
+       mm.provider,
+       mm.video_id,
+       coalesce(i.blurhash, ''),
+       coalesce(i.dominant_color, '')
+from movie_media mm
+left join images i on i.id = mm.url
+`
+
+func (r *MediaRepository) FindByMovie(c context.Context, movieId int, mediaType string) ([]models.MovieMedia, error) {
+	sql := mediaSelect + "where mm.movie_id = @movieId"
+	params := pgx.NamedArgs{"movieId": movieId}
+	if mediaType != "" {
+		sql += " and mm.type = @type"
+		params["type"] = mediaType
+	}
+	sql += " order by mm.position, mm.id"
+
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := make([]models.MovieMedia, 0)
+	for rows.Next() {
+		item, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+func (r *MediaRepository) FindById(c context.Context, movieId int, id int) (models.MovieMedia, error) {
+	row := r.db.QueryRow(c, mediaSelect+"where mm.movie_id = $1 and mm.id = $2", movieId, id)
+	return scanMedia(row)
+}
+
+func (r *MediaRepository) Create(c context.Context, media models.MovieMedia) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		c,
+		`
+insert into movie_media(movie_id, type, url, provider, video_id, language, position)
+values($1, $2, $3, $4, $5, $6, $7)
+returning id`,
+		media.MovieId,
+		media.Type,
+		media.Url,
+		media.Provider,
+		media.VideoId,
+		media.Language,
+		media.Position,
+	).Scan(&id)
+
+	return id, err
+}
+
+func (r *MediaRepository) Update(c context.Context, id int, media models.MovieMedia) error {
+	_, err := r.db.Exec(c, "update movie_media set language = $1, position = $2 where id = $3", media.Language, media.Position, id)
+	return err
+}
+
+func (r *MediaRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from movie_media where id = $1", id)
+	return err
+}
+
+// SetPrimary flags the poster as the primary one and makes it the movie poster shown in lists.
+// The id of the previous movie poster is returned so that its reference can be released.
+func (r *MediaRepository) SetPrimary(c context.Context, media models.MovieMedia) (string, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(c)
+
+	var previousPosterId string
+	err = tx.QueryRow(c, "select poster_id from movies where id = $1 for update", media.MovieId).Scan(&previousPosterId)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(c, "update movie_media set is_primary = false where movie_id = $1 and is_primary", media.MovieId)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(c, "update movie_media set is_primary = true where id = $1", media.Id)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(c, "update movies set poster_id = $1 where id = $2", media.Url, media.MovieId)
+	if err != nil {
+		return "", err
+	}
+
+	return previousPosterId, tx.Commit(c)
+}
+
+// ClearPrimary drops the primary flag when the movie poster was replaced directly.
+func (r *MediaRepository) ClearPrimary(c context.Context, movieId int) error {
+	_, err := r.db.Exec(c, "update movie_media set is_primary = false where movie_id = $1 and is_primary", movieId)
+	return err
+}
+
+func (r *MediaRepository) DeleteByMovie(c context.Context, movieId int) error {
+	_, err := r.db.Exec(c, "delete from movie_media where movie_id = $1", movieId)
+	return err
+}
+
+func scanMedia(row pgx.Row) (models.MovieMedia, error) {
+	var media models.MovieMedia
+	err := row.Scan(&media.Id, &media.MovieId, &media.Type, &media.Url, &media.Language, &media.Position,
+		&media.IsPrimary, &media.Provider, &media.VideoId, &media.Blurhash, &media.DominantColor)
+
+	return media, err
+}
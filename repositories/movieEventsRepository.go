@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+// moviePopularityLock keeps replicas from recomputing the popularity at the same time
+const moviePopularityLock = 7283403
+
+type MovieEventsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMovieEventsRepository(db *pgxpool.Pool) *MovieEventsRepository {
+	return &MovieEventsRepository{db: db}
+}
+
+func (r *MovieEventsRepository) Create(c context.Context, event models.MovieEvent) error {
+	_, err := r.db.Exec(
+		c,
+		"insert into movie_events(movie_id, profile_id, type, created_at) values($1, nullif($2, 0), $3, $4)",
+		event.MovieId,
+		event.ProfileId,
+		event.Type,
+		event.CreatedAt,
+	)
+
+	return err
+}
+
+// RefreshPopularity recomputes the popularity of the movies over every window. A profile counts once
+// per kind of event and movie, by its latest event, so that reloading a page doesn't make a movie
+// trend. False is returned when another replica is refreshing at the moment.
+func (r *MovieEventsRepository) RefreshPopularity(c context.Context, windows []models.PopularityWindow, now time.Time) (bool, error) {
+	return withTryAdvisoryLock(c, r.db, moviePopularityLock, func(tx pgx.Tx) error {
+		_, err := tx.Exec(c, "delete from movie_popularity")
+		if err != nil {
+			return err
+		}
+
+		for _, window := range windows {
+			_, err = tx.Exec(
+				c,
+				`
+insert into movie_popularity(movie_id, time_window, score, computed_at)
+select movie_id, @window::text, sum(score), @now::timestamp
+from (select movie_id,
+             max(case type
+                     when 'view' then @viewWeight::float8
+                     when 'watch' then @watchWeight::float8
+                     when 'rating' then @ratingWeight::float8
+                     else @watchlistWeight::float8
+                 end * power(0.5, extract(epoch from @now::timestamp - created_at)::float8 / @halfLife::float8)) as score
+      from movie_events
+      where created_at > @since
+      group by movie_id, profile_id, type) e
+group by movie_id`,
+				pgx.NamedArgs{
+					"window":          window.Name,
+					"now":             now,
+					"since":           now.Add(-window.Duration),
+					"halfLife":        window.HalfLife.Seconds(),
+					"viewWeight":      models.MovieEventWeights[models.MovieEventView],
+					"watchWeight":     models.MovieEventWeights[models.MovieEventWatch],
+					"ratingWeight":    models.MovieEventWeights[models.MovieEventRating],
+					"watchlistWeight": models.MovieEventWeights[models.MovieEventWatchlist],
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
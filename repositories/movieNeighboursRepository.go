@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+// movieNeighboursLock keeps replicas from recomputing the neighbours at the same time
+const movieNeighboursLock = 7283402
+
+type MovieNeighboursRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMovieNeighboursRepository(db *pgxpool.Pool) *MovieNeighboursRepository {
+	return &MovieNeighboursRepository{db: db}
+}
+
+// FindRatings returns every rating given by the profiles.
+func (r *MovieNeighboursRepository) FindRatings(c context.Context) ([]models.MovieRating, error) {
+	rows, err := r.db.Query(c, "select profile_id, movie_id, rating from profile_movies where rating > 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := make([]models.MovieRating, 0)
+	for rows.Next() {
+		var rating models.MovieRating
+		err := rows.Scan(&rating.ProfileId, &rating.MovieId, &rating.Rating)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ratings, nil
+}
+
+// FindByMovies returns the neighbours of the movies, the closest first.
+func (r *MovieNeighboursRepository) FindByMovies(c context.Context, movieIds []int) ([]models.MovieNeighbour, error) {
+	rows, err := r.db.Query(
+		c,
+		"select movie_id, neighbour_id, score from movie_neighbours where movie_id = any($1) order by score desc",
+		movieIds,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	neighbours := make([]models.MovieNeighbour, 0)
+	for rows.Next() {
+		var neighbour models.MovieNeighbour
+		err := rows.Scan(&neighbour.MovieId, &neighbour.NeighbourId, &neighbour.Score)
+		if err != nil {
+			return nil, err
+		}
+		neighbours = append(neighbours, neighbour)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return neighbours, nil
+}
+
+// Replace swaps all stored neighbours for the new ones. False is returned when another replica
+// is storing its neighbours at the moment.
+func (r *MovieNeighboursRepository) Replace(c context.Context, neighbours []models.MovieNeighbour, computedAt time.Time) (bool, error) {
+	return withTryAdvisoryLock(c, r.db, movieNeighboursLock, func(tx pgx.Tx) error {
+		_, err := tx.Exec(c, "delete from movie_neighbours")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CopyFrom(
+			c,
+			pgx.Identifier{"movie_neighbours"},
+			[]string{"movie_id", "neighbour_id", "score", "computed_at"},
+			pgx.CopyFromSlice(len(neighbours), func(i int) ([]any, error) {
+				return []any{neighbours[i].MovieId, neighbours[i].NeighbourId, neighbours[i].Score, computedAt}, nil
+			}),
+		)
+		return err
+	})
+}
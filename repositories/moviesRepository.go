@@ -17,7 +17,9 @@ func NewMoviesRepository(db *pgxpool.Pool) *MoviesRepository {
 	return &MoviesRepository{db: db}
 }
 
-func (r *MoviesRepository) FindAll(c context.Context, filters models.MovieFilters) ([]models.Movie, error) {
+// FindAll returns the movies the profile can see, with its ratings and watched state.
+// Without a profile every movie is returned, as seen by editors.
+func (r *MoviesRepository) FindAll(c context.Context, filters models.MovieFilters, profile *models.Profile) ([]models.Movie, error) {
 	sql :=
 		`
 select m.id, 
@@ -25,18 +27,41 @@ select m.id,
        m.description, 
        m.release_year, 
        m.director, 
-       m.rating, 
-       m.is_watched,
+       coalesce(pm.rating, 0), 
+       coalesce(pm.is_watched, false),
+       m.age_rating,
+       m.advisories,
+       (select count(*) from reviews r where r.movie_id = m.id and r.status = 'approved'),
+       coalesce(mp.score, 0),
+       coalesce((select json_agg(json_build_object('Id', t.id, 'Title', t.title) order by t.title)
+                 from movie_tags mt
+                 join tags t on t.id = mt.tag_id
+                 where mt.movie_id = m.id), '[]'),
        m.trailer_url, 
+       m.trailer_provider,
+       m.trailer_video_id,
        m.poster_id,
+       coalesce(i.blurhash, ''),
+       coalesce(i.dominant_color, ''),
        g.id,
-       g.title
+       g.title,
+       g.slug,
+       g.parent_id,
+       g.position
 from movies m 
 join movie_genres mg on mg.movie_id = m.id
 join genres g on g.id = mg.genre_id
+left join images i on i.id = m.poster_id
+left join profile_movies pm on pm.movie_id = m.id and pm.profile_id = @profileId
+left join movie_popularity mp on mp.movie_id = m.id and mp.time_window = @popularityWindow
 where 1 = 1`
 
-	params := pgx.NamedArgs{}
+	params := pgx.NamedArgs{"popularityWindow": models.PopularityWindowMonth}
+	sql = restrictToProfile(sql, params, profile)
+
+	if filters.PopularityWindow != "" {
+		params["popularityWindow"] = filters.PopularityWindow
+	}
 
 	if filters.SearchTerm != "" {
 		sql = fmt.Sprintf("%s and m.title ilike @s", sql)
@@ -45,13 +70,27 @@ where 1 = 1`
 	if filters.IsWatched != "" {
 		isWatched, _ := strconv.ParseBool(filters.IsWatched)
 
-		sql = fmt.Sprintf("%s and m.is_watched = @isWatched", sql)
+		sql = fmt.Sprintf("%s and coalesce(pm.is_watched, false) = @isWatched", sql)
 		params["isWatched"] = isWatched
 	}
-	if len(filters.GenreIds) > 0 {
+	if len(filters.GenreIds) > 0 && filters.IncludeSubgenres {
+		sql = fmt.Sprintf(`%s and g.id in (
+with recursive descendants as (
+    select id from genres where id = any(@genreIds)
+    union
+    select g2.id from genres g2 join descendants d on g2.parent_id = d.id
+)
+select id from descendants)`, sql)
+		params["genreIds"] = filters.GenreIds
+	} else if len(filters.GenreIds) > 0 {
 		sql = fmt.Sprintf("%s and g.id = any(@genreIds)", sql)
 		params["genreIds"] = filters.GenreIds
 	}
+	if len(filters.TagIds) > 0 {
+		sql = fmt.Sprintf("%s and m.id in (select movie_id from movie_tags where tag_id = any(@tagIds) group by movie_id having count(*) = @tagCount)", sql)
+		params["tagIds"] = filters.TagIds
+		params["tagCount"] = len(filters.TagIds)
+	}
 
 	if filters.Sort != "" {
 		o := "asc"
@@ -62,8 +101,7 @@ where 1 = 1`
 			filters.Sort = filters.Sort[1:]
 		}
 
-		identifier := pgx.Identifier{filters.Sort}
-		q := fmt.Sprintf("order by m.%s %s", identifier.Sanitize(), o)
+		q := fmt.Sprintf("order by %s %s", movieSortColumn(filters.Sort), o)
 		sql = fmt.Sprintf("%s %s", sql, q)
 	}
 
@@ -79,7 +117,10 @@ where 1 = 1`
 		var movie models.Movie
 		var genre models.Genre
 		err := rows.Scan(&movie.Id, &movie.Title, &movie.Description, &movie.ReleaseYear, &movie.Director,
-			&movie.Rating, &movie.IsWatched, &movie.TrailerUrl, &movie.PosterUrl, &genre.Id, &genre.Title)
+			&movie.Rating, &movie.IsWatched, &movie.AgeRating, &movie.Advisories, &movie.ReviewsCount, &movie.Popularity, &movie.Tags,
+			&movie.TrailerUrl, &movie.TrailerProvider, &movie.TrailerVideoId, &movie.PosterUrl,
+			&movie.PosterBlurhash, &movie.PosterColor, &genre.Id, &genre.Title,
+			&genre.Slug, &genre.ParentId, &genre.Position)
 		if err != nil {
 			return nil, err
 		}
@@ -104,7 +145,9 @@ where 1 = 1`
 	return concreteMovies, nil
 }
 
-func (r *MoviesRepository) FindById(c context.Context, id int) (models.Movie, error) {
+// FindById returns pgx.ErrNoRows when the movie doesn't exist or the profile can't see it.
+// Without a profile the movie is returned as seen by editors.
+func (r *MoviesRepository) FindById(c context.Context, id int, profile *models.Profile) (models.Movie, error) {
 	sql :=
 		`
 select m.id, 
@@ -112,18 +155,39 @@ select m.id,
        m.description, 
        m.release_year, 
        m.director, 
-       m.rating, 
+       coalesce(pm.rating, 0), 
+       coalesce(pm.is_watched, false),
+       m.age_rating,
+       m.advisories,
+       (select count(*) from reviews r where r.movie_id = m.id and r.status = 'approved'),
+       coalesce(mp.score, 0),
+       coalesce((select json_agg(json_build_object('Id', t.id, 'Title', t.title) order by t.title)
+                 from movie_tags mt
+                 join tags t on t.id = mt.tag_id
+                 where mt.movie_id = m.id), '[]'),
        m.trailer_url, 
+       m.trailer_provider,
+       m.trailer_video_id,
        m.poster_id,
+       coalesce(i.blurhash, ''),
+       coalesce(i.dominant_color, ''),
        g.id,
-       g.title
+       g.title,
+       g.slug,
+       g.parent_id,
+       g.position
 from movies m 
 join movie_genres mg on mg.movie_id = m.id
 join genres g on g.id = mg.genre_id
-where m.id = $1
-`
+left join images i on i.id = m.poster_id
+left join profile_movies pm on pm.movie_id = m.id and pm.profile_id = @profileId
+left join movie_popularity mp on mp.movie_id = m.id and mp.time_window = @popularityWindow
+where m.id = @id`
 
-	rows, err := r.db.Query(c, sql, id)
+	params := pgx.NamedArgs{"id": id, "popularityWindow": models.PopularityWindowMonth}
+	sql = restrictToProfile(sql, params, profile)
+
+	rows, err := r.db.Query(c, sql, params)
 	if err != nil {
 		return models.Movie{}, err
 	}
@@ -134,7 +198,10 @@ where m.id = $1
 		var movie models.Movie
 		var genre models.Genre
 		err := rows.Scan(&movie.Id, &movie.Title, &movie.Description, &movie.ReleaseYear, &movie.Director,
-			&movie.Rating, &movie.TrailerUrl, &movie.PosterUrl, &genre.Id, &genre.Title)
+			&movie.Rating, &movie.IsWatched, &movie.AgeRating, &movie.Advisories, &movie.ReviewsCount, &movie.Popularity, &movie.Tags,
+			&movie.TrailerUrl, &movie.TrailerProvider, &movie.TrailerVideoId, &movie.PosterUrl,
+			&movie.PosterBlurhash, &movie.PosterColor, &genre.Id, &genre.Title,
+			&genre.Slug, &genre.ParentId, &genre.Position)
 		if err != nil {
 			return models.Movie{}, err
 		}
@@ -163,14 +230,18 @@ func (r *MoviesRepository) Create(c context.Context, movie models.Movie) (int, e
 	err := r.db.QueryRow(
 		c,
 		`
-insert into movies(title, description, release_year, director, trailer_url, poster_id) 
-values($1, $2, $3, $4, $5, $6) 
+insert into movies(title, description, release_year, director, age_rating, advisories, trailer_url, trailer_provider, trailer_video_id, poster_id) 
+values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) 
 returning id`,
 		movie.Title,
 		movie.Description,
 		movie.ReleaseYear,
 		movie.Director,
+		movie.AgeRating,
+		movie.Advisories,
 		movie.TrailerUrl,
+		movie.TrailerProvider,
+		movie.TrailerVideoId,
 		movie.PosterUrl,
 	).Scan(&id)
 	if err != nil {
@@ -183,6 +254,12 @@ returning id`,
 			return 0, err
 		}
 	}
+	for _, tag := range movie.Tags {
+		_, err := r.db.Exec(c, "insert into movie_tags(movie_id, tag_id) values($1, $2)", id, tag.Id)
+		if err != nil {
+			return 0, err
+		}
+	}
 
 	return id, nil
 }
@@ -196,15 +273,23 @@ set title = $1,
     description = $2, 
     release_year = $3, 
     director = $4, 
-    trailer_url = $5, 
-    poster_id = $6 
-where id = $7
+    age_rating = $5,
+    advisories = $6,
+    trailer_url = $7, 
+    trailer_provider = $8,
+    trailer_video_id = $9,
+    poster_id = $10 
+where id = $11
 `,
 		movie.Title,
 		movie.Description,
 		movie.ReleaseYear,
 		movie.Director,
+		movie.AgeRating,
+		movie.Advisories,
 		movie.TrailerUrl,
+		movie.TrailerProvider,
+		movie.TrailerVideoId,
 		movie.PosterUrl,
 		id)
 	if err != nil {
@@ -221,6 +306,17 @@ where id = $7
 			return err
 		}
 	}
+
+	_, err = r.db.Exec(c, "delete from movie_tags where movie_id = $1", id)
+	if err != nil {
+		return err
+	}
+	for _, tag := range movie.Tags {
+		_, err := r.db.Exec(c, "insert into movie_tags(movie_id, tag_id) values($1, $2)", id, tag.Id)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -238,20 +334,64 @@ func (r *MoviesRepository) Delete(c context.Context, id int) error {
 	return err
 }
 
-func (r *MoviesRepository) SetRating(c context.Context, movieId int, rating int) error {
-	_, err := r.db.Exec(c, "update movies set rating = $1 where id = $2", rating, movieId)
-	if err != nil {
-		return err
+// SetRating stores the rating of the movie given by the profile.
+func (r *MoviesRepository) SetRating(c context.Context, profileId int, movieId int, rating int) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into profile_movies(profile_id, movie_id, rating)
+values($1, $2, $3)
+on conflict (profile_id, movie_id) do update set rating = excluded.rating`,
+		profileId,
+		movieId,
+		rating,
+	)
+
+	return err
+}
+
+// SetWatched marks the movie as watched, or not, by the profile.
+func (r *MoviesRepository) SetWatched(c context.Context, profileId int, movieId int, isWatched bool) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into profile_movies(profile_id, movie_id, is_watched)
+values($1, $2, $3)
+on conflict (profile_id, movie_id) do update set is_watched = excluded.is_watched`,
+		profileId,
+		movieId,
+		isWatched,
+	)
+
+	return err
+}
+
+// restrictToProfile binds the profile the per-profile columns are read for and hides movies
+// with an age rating above the one allowed for the profile.
+func restrictToProfile(sql string, params pgx.NamedArgs, profile *models.Profile) string {
+	params["profileId"] = 0
+	if profile == nil {
+		return sql
 	}
 
-	return nil
+	params["profileId"] = profile.Id
+	params["maxAgeRating"] = profile.AllowedAgeRating()
+
+	return fmt.Sprintf("%s and m.age_rating <= @maxAgeRating", sql)
 }
 
-func (r *MoviesRepository) SetWatched(c context.Context, movieId int, isWatched bool) error {
-	_, err := r.db.Exec(c, "update movies set is_watched = $1 where id = $2", isWatched, movieId)
-	if err != nil {
-		return err
+// movieSortColumn maps the sort parameter to a column, ratings and watched state come from the profile
+// and popularity from the window of the filters.
+func movieSortColumn(sort string) string {
+	switch sort {
+	case "rating":
+		return "coalesce(pm.rating, 0)"
+	case "is_watched":
+		return "coalesce(pm.is_watched, false)"
+	case "popularity":
+		return "coalesce(mp.score, 0)"
 	}
 
-	return nil
+	identifier := pgx.Identifier{sort}
+	return fmt.Sprintf("m.%s", identifier.Sanitize())
 }
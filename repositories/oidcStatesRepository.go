@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type OidcStatesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewOidcStatesRepository(db *pgxpool.Pool) *OidcStatesRepository {
+	return &OidcStatesRepository{db: db}
+}
+
+func (r *OidcStatesRepository) Create(c context.Context, state models.OidcLoginState) error {
+	// Abandoned logins are cleaned up along the way
+	_, err := r.db.Exec(c, "delete from oidc_login_states where expires_at < $1", time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		c,
+		"insert into oidc_login_states(state_hash, code_verifier, nonce, expires_at) values($1, $2, $3, $4)",
+		state.StateHash,
+		state.CodeVerifier,
+		state.Nonce,
+		state.ExpiresAt,
+	)
+
+	return err
+}
+
+// Consume removes the state so that it can only be used once.
+// pgx.ErrNoRows is returned for unknown and expired states.
+func (r *OidcStatesRepository) Consume(c context.Context, stateHash string) (models.OidcLoginState, error) {
+	var state models.OidcLoginState
+	err := r.db.QueryRow(
+		c,
+		`
+delete from oidc_login_states
+where state_hash = $1 and expires_at > $2
+returning state_hash, code_verifier, nonce, expires_at`,
+		stateHash,
+		time.Now(),
+	).Scan(&state.StateHash, &state.CodeVerifier, &state.Nonce, &state.ExpiresAt)
+
+	return state, err
+}
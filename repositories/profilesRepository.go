@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type ProfilesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewProfilesRepository(db *pgxpool.Pool) *ProfilesRepository {
+	return &ProfilesRepository{db: db}
+}
+
+const profileSelect = `
+select id, user_id, name, avatar, language, is_kids, max_age_rating, is_default, created_at
+from profiles
+`
+
+func (r *ProfilesRepository) FindAll(c context.Context, userId int) ([]models.Profile, error) {
+	rows, err := r.db.Query(c, profileSelect+"where user_id = $1 order by is_default desc, id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]models.Profile, 0)
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// FindById returns the profile only when it belongs to the user, pgx.ErrNoRows otherwise.
+func (r *ProfilesRepository) FindById(c context.Context, userId int, id int) (models.Profile, error) {
+	return scanProfile(r.db.QueryRow(c, profileSelect+"where id = $1 and user_id = $2", id, userId))
+}
+
+func (r *ProfilesRepository) FindDefault(c context.Context, userId int) (models.Profile, error) {
+	return scanProfile(r.db.QueryRow(c, profileSelect+"where user_id = $1 and is_default", userId))
+}
+
+func (r *ProfilesRepository) Count(c context.Context, userId int) (int, error) {
+	var count int
+	err := r.db.QueryRow(c, "select count(*) from profiles where user_id = $1", userId).Scan(&count)
+	return count, err
+}
+
+func (r *ProfilesRepository) Create(c context.Context, profile models.Profile) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		c,
+		`
+insert into profiles(user_id, name, avatar, language, is_kids, max_age_rating, is_default, created_at)
+values($1, $2, $3, $4, $5, $6, false, $7)
+returning id`,
+		profile.UserId,
+		profile.Name,
+		profile.Avatar,
+		profile.Language,
+		profile.IsKids,
+		profile.MaxAgeRating,
+		profile.CreatedAt,
+	).Scan(&id)
+
+	return id, err
+}
+
+func (r *ProfilesRepository) Update(c context.Context, profile models.Profile) error {
+	_, err := r.db.Exec(
+		c,
+		"update profiles set name = $1, avatar = $2, language = $3, is_kids = $4, max_age_rating = $5 where id = $6 and user_id = $7",
+		profile.Name,
+		profile.Avatar,
+		profile.Language,
+		profile.IsKids,
+		profile.MaxAgeRating,
+		profile.Id,
+		profile.UserId,
+	)
+
+	return err
+}
+
+// Delete removes the profile with its ratings and watchlist, the default profile is never deleted.
+func (r *ProfilesRepository) Delete(c context.Context, userId int, id int) error {
+	_, err := r.db.Exec(c, "delete from profiles where id = $1 and user_id = $2 and not is_default", id, userId)
+	return err
+}
+
+func scanProfile(row pgx.Row) (models.Profile, error) {
+	var profile models.Profile
+	err := row.Scan(
+		&profile.Id,
+		&profile.UserId,
+		&profile.Name,
+		&profile.Avatar,
+		&profile.Language,
+		&profile.IsKids,
+		&profile.MaxAgeRating,
+		&profile.IsDefault,
+		&profile.CreatedAt,
+	)
+
+	return profile, err
+}
@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type ReviewsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReviewsRepository(db *pgxpool.Pool) *ReviewsRepository {
+	return &ReviewsRepository{db: db}
+}
+
+// reviewSelect reads likes and reports for the profile bound to @profileId
+const reviewSelect = `
+select r.id,
+       r.movie_id,
+       r.user_id,
+       r.profile_id,
+       p.name,
+       r.text,
+       r.is_spoiler,
+       r.rating,
+       r.status,
+       (select count(*) from review_likes l where l.review_id = r.id),
+       (select count(*) from review_reports rr where rr.review_id = r.id and rr.created_at > coalesce(r.moderated_at, '-infinity')),
+       exists(select 1 from review_likes l where l.review_id = r.id and l.profile_id = @profileId),
+       r.created_at,
+       r.updated_at
+from reviews r
+join profiles p on p.id = r.profile_id
+`
+
+// FindByMovie returns approved reviews of the movie and the reviews of the profile itself, the newest first,
+// along with their total number.
+func (r *ReviewsRepository) FindByMovie(c context.Context, movieId int, profileId int, limit int, offset int) ([]models.Review, int, error) {
+	where := "where r.movie_id = @movieId and (r.status = @approved or r.profile_id = @profileId)"
+	params := pgx.NamedArgs{
+		"movieId":   movieId,
+		"profileId": profileId,
+		"approved":  models.ReviewStatusApproved,
+		"limit":     limit,
+		"offset":    offset,
+	}
+
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from reviews r "+where, params).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sql := fmt.Sprintf("%s %s order by r.created_at desc, r.id desc limit @limit offset @offset", reviewSelect, where)
+	reviews, err := r.findAll(c, sql, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// FindModerationQueue returns the reviews waiting for approval and the ones reported since they were moderated,
+// the oldest first.
+func (r *ReviewsRepository) FindModerationQueue(c context.Context, limit int, offset int) ([]models.Review, error) {
+	sql := reviewSelect + `
+where r.status = @pending
+   or exists(select 1 from review_reports rr where rr.review_id = r.id and rr.created_at > coalesce(r.moderated_at, '-infinity'))
+order by r.updated_at, r.id
+limit @limit offset @offset`
+
+	return r.findAll(c, sql, pgx.NamedArgs{
+		"pending":   models.ReviewStatusPending,
+		"profileId": 0,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+func (r *ReviewsRepository) FindById(c context.Context, id int, profileId int) (models.Review, error) {
+	return scanReview(r.db.QueryRow(c, reviewSelect+"where r.id = @id", pgx.NamedArgs{"id": id, "profileId": profileId}))
+}
+
+// FindIdByAuthor returns the id of the review the profile wrote for the movie, pgx.ErrNoRows if there's none.
+func (r *ReviewsRepository) FindIdByAuthor(c context.Context, movieId int, profileId int) (int, error) {
+	var id int
+	err := r.db.QueryRow(c, "select id from reviews where movie_id = $1 and profile_id = $2", movieId, profileId).Scan(&id)
+	return id, err
+}
+
+func (r *ReviewsRepository) Create(c context.Context, review models.Review) (int, error) {
+	var id int
+	err := r.db.QueryRow(
+		c,
+		`
+insert into reviews(movie_id, user_id, profile_id, text, is_spoiler, rating, status, created_at, updated_at)
+values($1, $2, $3, $4, $5, $6, $7, $8, $8)
+returning id`,
+		review.MovieId,
+		review.UserId,
+		review.ProfileId,
+		review.Text,
+		review.IsSpoiler,
+		review.Rating,
+		review.Status,
+		review.CreatedAt,
+	).Scan(&id)
+
+	return id, err
+}
+
+func (r *ReviewsRepository) Update(c context.Context, review models.Review) error {
+	_, err := r.db.Exec(
+		c,
+		"update reviews set text = $1, is_spoiler = $2, rating = $3, status = $4, updated_at = $5 where id = $6",
+		review.Text,
+		review.IsSpoiler,
+		review.Rating,
+		review.Status,
+		review.UpdatedAt,
+		review.Id,
+	)
+
+	return err
+}
+
+func (r *ReviewsRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from reviews where id = $1", id)
+	return err
+}
+
+// SetStatus records the moderation decision, reports made before it are resolved by it.
+func (r *ReviewsRepository) SetStatus(c context.Context, id int, status string) error {
+	_, err := r.db.Exec(c, "update reviews set status = $1, moderated_at = $2 where id = $3", status, time.Now(), id)
+	return err
+}
+
+func (r *ReviewsRepository) Like(c context.Context, id int, profileId int) error {
+	_, err := r.db.Exec(
+		c,
+		"insert into review_likes(review_id, profile_id, created_at) values($1, $2, $3) on conflict do nothing",
+		id,
+		profileId,
+		time.Now(),
+	)
+
+	return err
+}
+
+func (r *ReviewsRepository) Unlike(c context.Context, id int, profileId int) error {
+	_, err := r.db.Exec(c, "delete from review_likes where review_id = $1 and profile_id = $2", id, profileId)
+	return err
+}
+
+// Report stores the report of the profile, reporting again replaces the reason.
+func (r *ReviewsRepository) Report(c context.Context, report models.ReviewReport) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into review_reports(review_id, profile_id, reason, created_at)
+values($1, $2, $3, $4)
+on conflict (review_id, profile_id) do update set reason = excluded.reason, created_at = excluded.created_at`,
+		report.ReviewId,
+		report.ProfileId,
+		report.Reason,
+		report.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *ReviewsRepository) findAll(c context.Context, sql string, params pgx.NamedArgs) ([]models.Review, error) {
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]models.Review, 0)
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+func scanReview(row pgx.Row) (models.Review, error) {
+	var review models.Review
+	err := row.Scan(
+		&review.Id,
+		&review.MovieId,
+		&review.UserId,
+		&review.ProfileId,
+		&review.AuthorName,
+		&review.Text,
+		&review.IsSpoiler,
+		&review.Rating,
+		&review.Status,
+		&review.LikesCount,
+		&review.ReportsCount,
+		&review.IsLiked,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+
+	return review, err
+}
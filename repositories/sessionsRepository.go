@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type SessionsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionsRepository(db *pgxpool.Pool) *SessionsRepository {
+	return &SessionsRepository{db: db}
+}
+
+const sessionSelect = `
+select id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+from user_sessions
+`
+
+func (r *SessionsRepository) Create(c context.Context, session models.Session) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into user_sessions(id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+values($1, $2, $3, $4, $5, $5, $6)`,
+		session.Id,
+		session.UserId,
+		session.UserAgent,
+		session.Ip,
+		session.CreatedAt,
+		session.ExpiresAt,
+	)
+
+	return err
+}
+
+// FindActive returns the session unless it was revoked or has expired, pgx.ErrNoRows otherwise.
+func (r *SessionsRepository) FindActive(c context.Context, userId int, id string) (models.Session, error) {
+	sql := sessionSelect + "where id = $1 and user_id = $2 and revoked_at is null and expires_at > $3"
+	return scanSession(r.db.QueryRow(c, sql, id, userId, time.Now()))
+}
+
+// FindAllActive returns the sessions of the user which can still be used, the most recently seen first.
+func (r *SessionsRepository) FindAllActive(c context.Context, userId int) ([]models.Session, error) {
+	sql := sessionSelect + "where user_id = $1 and revoked_at is null and expires_at > $2 order by last_seen_at desc"
+	rows, err := r.db.Query(c, sql, userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Touch updates the last seen time, but at most once per interval to avoid a write on every request.
+func (r *SessionsRepository) Touch(c context.Context, id string, interval time.Duration) error {
+	now := time.Now()
+	_, err := r.db.Exec(
+		c,
+		"update user_sessions set last_seen_at = $1 where id = $2 and last_seen_at < $3",
+		now,
+		id,
+		now.Add(-interval),
+	)
+
+	return err
+}
+
+// Revoke returns false when the user has no active session with the id.
+func (r *SessionsRepository) Revoke(c context.Context, userId int, id string) (bool, error) {
+	tag, err := r.db.Exec(
+		c,
+		"update user_sessions set revoked_at = $1 where id = $2 and user_id = $3 and revoked_at is null",
+		time.Now(),
+		id,
+		userId,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// RevokeAll signs the user out everywhere, e.g. when the password is reset.
+func (r *SessionsRepository) RevokeAll(c context.Context, userId int) error {
+	_, err := r.db.Exec(
+		c,
+		"update user_sessions set revoked_at = $1 where user_id = $2 and revoked_at is null",
+		time.Now(),
+		userId,
+	)
+
+	return err
+}
+
+func scanSession(row pgx.Row) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.Id, &session.UserId, &session.UserAgent, &session.Ip, &session.CreatedAt,
+		&session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+
+	return session, err
+}
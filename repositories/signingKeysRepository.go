@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+// signingKeysLock serialises rotations across replicas
+const signingKeysLock = 7283401
+
+// freshSigningKeyQuery tells whether a current key of the algorithm $1 was created after $2
+const freshSigningKeyQuery = "select exists(select 1 from signing_keys where retired_at is null and algorithm = $1 and created_at > $2)"
+
+type SigningKeysRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSigningKeysRepository(db *pgxpool.Pool) *SigningKeysRepository {
+	return &SigningKeysRepository{db: db}
+}
+
+// FindValid returns the keys which can still verify tokens, the newest first.
+func (r *SigningKeysRepository) FindValid(c context.Context) ([]models.SigningKey, error) {
+	rows, err := r.db.Query(
+		c,
+		`
+select id, algorithm, private_key, public_key, created_at, retired_at, expires_at
+from signing_keys
+where expires_at is null or expires_at > $1
+order by created_at desc`,
+		time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.SigningKey, 0)
+	for rows.Next() {
+		var key models.SigningKey
+		err := rows.Scan(&key.Id, &key.Algorithm, &key.PrivateKey, &key.PublicKey, &key.CreatedAt, &key.RetiredAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// IsRotationDue tells whether there is no current key of the algorithm created within the interval.
+func (r *SigningKeysRepository) IsRotationDue(c context.Context, algorithm string, now time.Time, interval time.Duration) (bool, error) {
+	var fresh bool
+	err := r.db.QueryRow(c, freshSigningKeyQuery, algorithm, now.Add(-interval)).Scan(&fresh)
+	return !fresh, err
+}
+
+// Rotate stores the new key and retires the current ones, which keep verifying tokens for the grace period.
+// Nothing is changed when another replica has already put a fresh key of the algorithm in place,
+// in which case false is returned.
+func (r *SigningKeysRepository) Rotate(c context.Context, key models.SigningKey, interval time.Duration, grace time.Duration) (bool, error) {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(c, "select pg_advisory_xact_lock($1)", signingKeysLock)
+	if err != nil {
+		return false, err
+	}
+
+	var fresh bool
+	err = tx.QueryRow(c, freshSigningKeyQuery, key.Algorithm, key.CreatedAt.Add(-interval)).Scan(&fresh)
+	if err != nil {
+		return false, err
+	}
+	if fresh {
+		return false, nil
+	}
+
+	_, err = tx.Exec(
+		c,
+		"update signing_keys set retired_at = $1, expires_at = $2 where retired_at is null",
+		key.CreatedAt,
+		key.CreatedAt.Add(grace),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(c, "delete from signing_keys where expires_at < $1", key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(
+		c,
+		"insert into signing_keys(id, algorithm, private_key, public_key, created_at) values($1, $2, $3, $4, $5)",
+		key.Id,
+		key.Algorithm,
+		key.PrivateKey,
+		key.PublicKey,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(c)
+}
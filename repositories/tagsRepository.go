@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type TagsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTagsRepository(db *pgxpool.Pool) *TagsRepository {
+	return &TagsRepository{db: db}
+}
+
+func (r *TagsRepository) FindAll(c context.Context) ([]models.Tag, error) {
+	return r.findAll(c, "select id, title from tags order by title")
+}
+
+// Autocomplete returns the tags containing the term, the ones starting with it and the most used first.
+// The term is matched as plain text, % and _ in it are not wildcards.
+func (r *TagsRepository) Autocomplete(c context.Context, term string, limit int) ([]models.Tag, error) {
+	return r.findAll(
+		c,
+		`
+select t.id, t.title
+from tags t
+where strpos(lower(t.title), lower($1)) > 0
+order by strpos(lower(t.title), lower($1)) <> 1,
+         (select count(*) from movie_tags mt where mt.tag_id = t.id) desc,
+         t.title
+limit $2`,
+		term,
+		limit,
+	)
+}
+
+func (r *TagsRepository) FindById(c context.Context, id int) (models.Tag, error) {
+	var tag models.Tag
+	err := r.db.QueryRow(c, "select id, title from tags where id = $1", id).Scan(&tag.Id, &tag.Title)
+	return tag, err
+}
+
+// FindByTitle looks the tag up regardless of case, pgx.ErrNoRows if there's none.
+func (r *TagsRepository) FindByTitle(c context.Context, title string) (models.Tag, error) {
+	var tag models.Tag
+	err := r.db.QueryRow(c, "select id, title from tags where lower(title) = lower($1)", title).Scan(&tag.Id, &tag.Title)
+	return tag, err
+}
+
+func (r *TagsRepository) Create(c context.Context, tag models.Tag) (int, error) {
+	var id int
+	err := r.db.QueryRow(c, "insert into tags(title) values($1) returning id", tag.Title).Scan(&id)
+	return id, err
+}
+
+func (r *TagsRepository) Update(c context.Context, tag models.Tag) error {
+	_, err := r.db.Exec(c, "update tags set title = $1 where id = $2", tag.Title, tag.Id)
+	return err
+}
+
+func (r *TagsRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from tags where id = $1", id)
+	return err
+}
+
+func (r *TagsRepository) findAll(c context.Context, sql string, args ...any) ([]models.Tag, error) {
+	rows, err := r.db.Query(c, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]models.Tag, 0)
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Id, &tag.Title); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
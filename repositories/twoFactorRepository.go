@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type TwoFactorRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(db *pgxpool.Pool) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+func (r *TwoFactorRepository) Find(c context.Context, userId int) (models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	err := r.db.QueryRow(c, "select user_id, secret, is_enabled, last_used_step from user_two_factor where user_id = $1", userId).
+		Scan(&twoFactor.UserId, &twoFactor.Secret, &twoFactor.IsEnabled, &twoFactor.LastUsedStep)
+
+	return twoFactor, err
+}
+
+// IsEnabled reports whether the user has to pass the second factor when signing in.
+func (r *TwoFactorRepository) IsEnabled(c context.Context, userId int) (bool, error) {
+	twoFactor, err := r.Find(c, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	return twoFactor.IsEnabled, err
+}
+
+// SavePending stores a new secret waiting for the confirmation with a code.
+func (r *TwoFactorRepository) SavePending(c context.Context, userId int, secret string) error {
+	_, err := r.db.Exec(
+		c,
+		`
+insert into user_two_factor(user_id, secret, is_enabled, last_used_step)
+values($1, $2, false, 0)
+on conflict (user_id) do update set secret = $2, is_enabled = false, last_used_step = 0`,
+		userId,
+		secret,
+	)
+
+	return err
+}
+
+func (r *TwoFactorRepository) Enable(c context.Context, userId int) error {
+	_, err := r.db.Exec(c, "update user_two_factor set is_enabled = true where user_id = $1", userId)
+	return err
+}
+
+func (r *TwoFactorRepository) Disable(c context.Context, userId int) error {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(c, "delete from user_recovery_codes where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(c, "delete from user_two_factor where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(c)
+}
+
+// UseStep remembers the time step of an accepted code. False is returned when a code of
+// this or a later step was already used, so that a code can't be replayed.
+func (r *TwoFactorRepository) UseStep(c context.Context, userId int, step int64) (bool, error) {
+	tag, err := r.db.Exec(
+		c,
+		"update user_two_factor set last_used_step = $1 where user_id = $2 and last_used_step < $1",
+		step,
+		userId,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(c context.Context, userId int, codeHashes []string) error {
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	_, err = tx.Exec(c, "delete from user_recovery_codes where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(c, "insert into user_recovery_codes(user_id, code_hash) values($1, $2)", userId, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(c)
+}
+
+// UseRecoveryCode marks the code as used, false is returned for unknown or used codes.
+func (r *TwoFactorRepository) UseRecoveryCode(c context.Context, userId int, codeHash string) (bool, error) {
+	tag, err := r.db.Exec(
+		c,
+		"update user_recovery_codes set used_at = $1 where user_id = $2 and code_hash = $3 and used_at is null",
+		time.Now(),
+		userId,
+		codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+)
+
+type UserIdentitiesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUserIdentitiesRepository(db *pgxpool.Pool) *UserIdentitiesRepository {
+	return &UserIdentitiesRepository{db: db}
+}
+
+func (r *UserIdentitiesRepository) Find(c context.Context, issuer string, subject string) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.QueryRow(
+		c,
+		"select issuer, subject, user_id, email, provisioned from user_identities where issuer = $1 and subject = $2",
+		issuer,
+		subject,
+	).Scan(&identity.Issuer, &identity.Subject, &identity.UserId, &identity.Email, &identity.Provisioned)
+
+	return identity, err
+}
+
+func (r *UserIdentitiesRepository) Create(c context.Context, identity models.UserIdentity) error {
+	_, err := r.db.Exec(
+		c,
+		"insert into user_identities(issuer, subject, user_id, email, provisioned) values($1, $2, $3, $4, $5)",
+		identity.Issuer,
+		identity.Subject,
+		identity.UserId,
+		identity.Email,
+		identity.Provisioned,
+	)
+
+	return err
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"ozinshe-final-project/models"
+	"time"
+)
+
+type UserTokensRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUserTokensRepository(db *pgxpool.Pool) *UserTokensRepository {
+	return &UserTokensRepository{db: db}
+}
+
+func (r *UserTokensRepository) Create(c context.Context, token models.UserToken) error {
+	_, err := r.db.Exec(
+		c,
+		"insert into user_tokens(user_id, purpose, token_hash, expires_at) values($1, $2, $3, $4)",
+		token.UserId,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+	)
+
+	return err
+}
+
+// FindUserId returns the user of a valid token without using it up.
+func (r *UserTokensRepository) FindUserId(c context.Context, purpose string, tokenHash string) (int, error) {
+	var userId int
+	err := r.db.QueryRow(
+		c,
+		"select user_id from user_tokens where purpose = $1 and token_hash = $2 and used_at is null and expires_at > $3",
+		purpose,
+		tokenHash,
+		time.Now(),
+	).Scan(&userId)
+
+	return userId, err
+}
+
+// Consume marks a valid token as used and returns the id of its user.
+// pgx.ErrNoRows is returned for unknown, expired and already used tokens.
+func (r *UserTokensRepository) Consume(c context.Context, purpose string, tokenHash string) (int, error) {
+	var userId int
+	err := r.db.QueryRow(
+		c,
+		`
+update user_tokens
+set used_at = $1
+where purpose = $2 and token_hash = $3 and used_at is null and expires_at > $1
+returning user_id`,
+		time.Now(),
+		purpose,
+		tokenHash,
+	).Scan(&userId)
+
+	return userId, err
+}
+
+// Invalidate marks all unused tokens of the user for the purpose as used.
+func (r *UserTokensRepository) Invalidate(c context.Context, userId int, purpose string) error {
+	_, err := r.db.Exec(
+		c,
+		"update user_tokens set used_at = $1 where user_id = $2 and purpose = $3 and used_at is null",
+		time.Now(),
+		userId,
+		purpose,
+	)
+
+	return err
+}
@@ -15,16 +15,16 @@ func NewUsersRepository(db *pgxpool.Pool) *UsersRepository {
 }
 
 func (u *UsersRepository) FindById(c context.Context, id int) (models.User, error) {
-	row := u.db.QueryRow(c, "select id, name, email, password_hash from users where id = $1", id)
+	row := u.db.QueryRow(c, "select id, name, email, password_hash, is_verified, role from users where id = $1", id)
 
 	var user models.User
-	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash)
+	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.Role)
 
 	return user, err
 }
 
 func (u *UsersRepository) FindAll(c context.Context) ([]models.User, error) {
-	rows, err := u.db.Query(c, "select id, name, email, password_hash from users order by id")
+	rows, err := u.db.Query(c, "select id, name, email, password_hash, is_verified, role from users order by id")
 	if err != nil {
 		return nil, err
 	}
@@ -32,7 +32,7 @@ func (u *UsersRepository) FindAll(c context.Context) ([]models.User, error) {
 	users := make([]models.User, 0)
 	for rows.Next() {
 		var user models.User
-		err = rows.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash)
+		err = rows.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.Role)
 		if err != nil {
 			return nil, err
 		}
@@ -43,24 +43,67 @@ func (u *UsersRepository) FindAll(c context.Context) ([]models.User, error) {
 	return users, nil
 }
 
+// FindByEmail ignores the case of the email, users created before emails were lowercased may have capitals.
+// Emails are unique regardless of the case, so at most one user matches.
 func (u *UsersRepository) FindByEmail(c context.Context, email string) (models.User, error) {
-	row := u.db.QueryRow(c, "select id, name, email, password_hash from users where email = $1", email)
+	row := u.db.QueryRow(c, "select id, name, email, password_hash, is_verified, role from users where lower(email) = lower($1)", email)
 
 	var user models.User
-	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash)
+	err := row.Scan(&user.Id, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.Role)
 
 	return user, err
 }
 
+// Create adds the user together with their default profile.
 func (u *UsersRepository) Create(c context.Context, user models.User) (int, error) {
 	var id int
-	err := u.db.QueryRow(c, "insert into users(name, email, password_hash) values ($1, $2, $3) returning id", user.Name, user.Email, user.PasswordHash).Scan(&id)
+	err := u.db.QueryRow(
+		c,
+		`
+with new_user as (
+    insert into users(name, email, password_hash, is_verified, role)
+    values ($1, $2, $3, $4, $5)
+    returning id
+), default_profile as (
+    insert into profiles(user_id, name, is_default, created_at)
+    select id, $1, true, now() from new_user
+)
+select id from new_user`,
+		user.Name,
+		user.Email,
+		user.PasswordHash,
+		user.IsVerified,
+		user.Role,
+	).Scan(&id)
 
 	return id, err
 }
 
 func (u *UsersRepository) Update(c context.Context, id int, user models.User) error {
-	_, err := u.db.Exec(c, "update users set name = $1, email = $2, password_hash = $3 where id = $4", user.Name, user.Email, user.PasswordHash, id)
+	_, err := u.db.Exec(
+		c,
+		"update users set name = $1, email = $2, password_hash = $3, is_verified = $4 where id = $5",
+		user.Name,
+		user.Email,
+		user.PasswordHash,
+		user.IsVerified,
+		id,
+	)
+	return err
+}
+
+func (u *UsersRepository) SetPasswordHash(c context.Context, id int, passwordHash string) error {
+	_, err := u.db.Exec(c, "update users set password_hash = $1 where id = $2", passwordHash, id)
+	return err
+}
+
+func (u *UsersRepository) SetVerified(c context.Context, id int) error {
+	_, err := u.db.Exec(c, "update users set is_verified = true where id = $1", id)
+	return err
+}
+
+func (u *UsersRepository) SetRole(c context.Context, id int, role string) error {
+	_, err := u.db.Exec(c, "update users set role = $1 where id = $2", role, id)
 	return err
 }
 
@@ -68,3 +111,16 @@ func (u *UsersRepository) Delete(c context.Context, id int) error {
 	_, err := u.db.Exec(c, "delete from users where id = $1", id)
 	return err
 }
+
+// FindParentalPinHash returns an empty hash when the user has not set a parental PIN.
+func (u *UsersRepository) FindParentalPinHash(c context.Context, id int) (string, error) {
+	var pinHash string
+	err := u.db.QueryRow(c, "select coalesce(parental_pin_hash, '') from users where id = $1", id).Scan(&pinHash)
+	return pinHash, err
+}
+
+// SetParentalPinHash sets the parental PIN, an empty hash turns parental controls off.
+func (u *UsersRepository) SetParentalPinHash(c context.Context, id int, pinHash string) error {
+	_, err := u.db.Exec(c, "update users set parental_pin_hash = nullif($1, '') where id = $2", pinHash, id)
+	return err
+}
@@ -2,6 +2,8 @@ package repositories
 
 import (
 	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"ozinshe-final-project/models"
 	"time"
@@ -15,26 +17,49 @@ func NewWatchlistRepository(db *pgxpool.Pool) *WatchlistRepository {
 	return &WatchlistRepository{db: db}
 }
 
-func (r *WatchlistRepository) GetMoviesFromWatchlist(c context.Context) ([]models.Movie, error) {
+// GetMoviesFromWatchlist returns the watchlist of the profile, leaving out movies it can't see.
+func (r *WatchlistRepository) GetMoviesFromWatchlist(c context.Context, profile models.Profile) ([]models.Movie, error) {
 	sql := `
 select m.id, 
        m.title, 
        m.description, 
        m.release_year, 
        m.director, 
-       m.rating, 
+       coalesce(pm.rating, 0), 
+       coalesce(pm.is_watched, false),
+       m.age_rating,
+       m.advisories,
+       (select count(*) from reviews r where r.movie_id = m.id and r.status = 'approved'),
+       coalesce(mp.score, 0),
+       coalesce((select json_agg(json_build_object('Id', t.id, 'Title', t.title) order by t.title)
+                 from movie_tags mt
+                 join tags t on t.id = mt.tag_id
+                 where mt.movie_id = m.id), '[]'),
        m.trailer_url, 
+       m.trailer_provider,
+       m.trailer_video_id,
        m.poster_id,
+       coalesce(i.blurhash, ''),
+       coalesce(i.dominant_color, ''),
        g.id,
-       g.title
+       g.title,
+       g.slug,
+       g.parent_id,
+       g.position
 from watchlist wl
 join movies m on wl.movie_id = m.id
 join movie_genres mg on m.id = mg.movie_id
 join genres g on mg.genre_id = g.id
-order by wl.added_at
-`
+left join images i on i.id = m.poster_id
+left join profile_movies pm on pm.movie_id = m.id and pm.profile_id = wl.profile_id
+left join movie_popularity mp on mp.movie_id = m.id and mp.time_window = @popularityWindow
+where wl.profile_id = @profileId`
 
-	rows, err := r.db.Query(c, sql)
+	params := pgx.NamedArgs{"popularityWindow": models.PopularityWindowMonth}
+	sql = restrictToProfile(sql, params, &profile)
+	sql = fmt.Sprintf("%s order by wl.added_at", sql)
+
+	rows, err := r.db.Query(c, sql, params)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +71,10 @@ order by wl.added_at
 		var movie models.Movie
 		var genre models.Genre
 		err := rows.Scan(&movie.Id, &movie.Title, &movie.Description, &movie.ReleaseYear, &movie.Director,
-			&movie.Rating, &movie.TrailerUrl, &movie.PosterUrl, &genre.Id, &genre.Title)
+			&movie.Rating, &movie.IsWatched, &movie.AgeRating, &movie.Advisories, &movie.ReviewsCount, &movie.Popularity, &movie.Tags,
+			&movie.TrailerUrl, &movie.TrailerProvider, &movie.TrailerVideoId, &movie.PosterUrl,
+			&movie.PosterBlurhash, &movie.PosterColor, &genre.Id, &genre.Title,
+			&genre.Slug, &genre.ParentId, &genre.Position)
 		if err != nil {
 			return nil, err
 		}
@@ -71,12 +99,12 @@ order by wl.added_at
 
 }
 
-func (r *WatchlistRepository) AddToWatchlist(c context.Context, movieId int) error {
-	_, err := r.db.Exec(c, "insert into watchlist(movie_id, added_at) values($1, $2)", movieId, time.Now())
+func (r *WatchlistRepository) AddToWatchlist(c context.Context, profileId int, movieId int) error {
+	_, err := r.db.Exec(c, "insert into watchlist(profile_id, movie_id, added_at) values($1, $2, $3)", profileId, movieId, time.Now())
 	return err
 }
 
-func (r *WatchlistRepository) RemoveFromWatchlist(c context.Context, movieId int) error {
-	_, err := r.db.Exec(c, "delete from watchlist where movie_id = $1", movieId)
+func (r *WatchlistRepository) RemoveFromWatchlist(c context.Context, profileId int, movieId int) error {
+	_, err := r.db.Exec(c, "delete from watchlist where profile_id = $1 and movie_id = $2", profileId, movieId)
 	return err
 }
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+const (
+	blurhashComponentsX = 4
+	blurhashComponentsY = 3
+	// Placeholders are tiny, so the image is sampled down before encoding
+	placeholderSampleSize = 64
+	base83Characters      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+type rgb struct {
+	r, g, b int
+}
+
+// EncodeBlurhash computes the blurhash (https://blurha.sh) placeholder of the image.
+func EncodeBlurhash(img image.Image) string {
+	pixels, width, height := samplePixels(img)
+	if width == 0 || height == 0 {
+		return ""
+	}
+
+	factors := make([][3]float64, 0, blurhashComponentsX*blurhashComponentsY)
+	for j := 0; j < blurhashComponentsY; j++ {
+		for i := 0; i < blurhashComponentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					pixel := pixels[y*width+x]
+					factor[0] += basis * sRGBToLinear(pixel.r)
+					factor[1] += basis * sRGBToLinear(pixel.g)
+					factor[2] += basis * sRGBToLinear(pixel.b)
+				}
+			}
+
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	dc, ac := factors[0], factors[1:]
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((blurhashComponentsX-1)+(blurhashComponentsY-1)*9, 1))
+
+	actualMaximum := 0.0
+	for _, factor := range ac {
+		for _, value := range factor {
+			actualMaximum = math.Max(actualMaximum, math.Abs(value))
+		}
+	}
+	quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+	maximumValue := float64(quantisedMaximum+1) / 166
+	hash.WriteString(encodeBase83(quantisedMaximum, 1))
+
+	dcValue := linearToSRGB(dc[0])<<16 + linearToSRGB(dc[1])<<8 + linearToSRGB(dc[2])
+	hash.WriteString(encodeBase83(dcValue, 4))
+
+	for _, factor := range ac {
+		quantise := func(value float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+
+	return hash.String()
+}
+
+// DominantColor returns the most common colour of the image as a #rrggbb string.
+func DominantColor(img image.Image) string {
+	pixels, _, _ := samplePixels(img)
+	if len(pixels) == 0 {
+		return ""
+	}
+
+	// Colours are grouped into buckets of 4 bits per channel, the average of the largest bucket wins
+	type bucket struct {
+		count      int
+		r, g, b    int
+		firstIndex int
+	}
+	buckets := make(map[int]*bucket)
+	for i, pixel := range pixels {
+		key := (pixel.r>>4)<<8 | (pixel.g>>4)<<4 | pixel.b>>4
+		if _, exists := buckets[key]; !exists {
+			buckets[key] = &bucket{firstIndex: i}
+		}
+		b := buckets[key]
+		b.count++
+		b.r += pixel.r
+		b.g += pixel.g
+		b.b += pixel.b
+	}
+
+	var best *bucket
+	for _, b := range buckets {
+		if best == nil || b.count > best.count || (b.count == best.count && b.firstIndex < best.firstIndex) {
+			best = b
+		}
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+func samplePixels(img image.Image) ([]rgb, int, int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, 0, 0
+	}
+
+	sampleWidth, sampleHeight := width, height
+	if width > placeholderSampleSize || height > placeholderSampleSize {
+		if width >= height {
+			sampleWidth = placeholderSampleSize
+			sampleHeight = max(1, height*placeholderSampleSize/width)
+		} else {
+			sampleHeight = placeholderSampleSize
+			sampleWidth = max(1, width*placeholderSampleSize/height)
+		}
+	}
+
+	pixels := make([]rgb, 0, sampleWidth*sampleHeight)
+	for y := 0; y < sampleHeight; y++ {
+		for x := 0; x < sampleWidth; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*width/sampleWidth, bounds.Min.Y+y*height/sampleHeight).RGBA()
+			pixels = append(pixels, rgb{int(r >> 8), int(g >> 8), int(b >> 8)})
+		}
+	}
+
+	return pixels, sampleWidth, sampleHeight
+}
+
+func encodeBase83(value int, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Characters[digit]
+	}
+
+	return string(result)
+}
+
+func sRGBToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// fillImage paints the image width×height in the colours, each colour filling its share of the rows from the top.
+func fillImage(width int, height int, colours ...color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colours[y*len(colours)/height])
+		}
+	}
+
+	return img
+}
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	white = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black = color.RGBA{A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+)
+
+func TestEncodeBlurhash(t *testing.T) {
+	// Like the reference encoder the basis starts at the pixel corners, so even a plain image has some
+	// AC components, e.g. 0.25 of the colour for the first horizontal and vertical ones of an 8×8 image
+	tests := []struct {
+		name string
+		img  image.Image
+		want string
+	}{
+		{"red", fillImage(8, 8, red), "LfTI:j|cfQ|c|csUfQsUfQfQfQfQ"},
+		{"white", fillImage(8, 8, white), "LfTSUA~qfQ~q~qt7fQt7fQfQfQfQ"},
+		{"black", fillImage(8, 8, black), "L00000fQfQfQfQfQfQfQfQfQfQfQ"},
+		{"large image is sampled", fillImage(300, 200, red), "L7TI:j;$fQ;$|cjtfQjtfQfQfQfQ"},
+		{"empty", image.NewRGBA(image.Rect(0, 0, 0, 0)), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := EncodeBlurhash(test.img); got != test.want {
+				t.Errorf("EncodeBlurhash() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want string
+	}{
+		{"plain", fillImage(8, 8, red), "#ff0000"},
+		{"majority wins", fillImage(8, 8, blue, blue, blue, red), "#0000ff"},
+		{"tie goes to the first colour", fillImage(8, 8, white, black), "#ffffff"},
+		{"close shades are averaged", fillImage(8, 8, color.RGBA{R: 250, A: 255}, color.RGBA{R: 240, A: 255}), "#f50000"},
+		{"empty", image.NewRGBA(image.Rect(0, 0, 0, 0)), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DominantColor(test.img); got != test.want {
+				t.Errorf("DominantColor() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package services
+
+import "strings"
+
+// NormalizeEmail is the form emails are stored and compared in, users type them in any case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"ozinshe-final-project/config"
+	"strconv"
+	"time"
+)
+
+// SignImageId appends an expiry and a signature to the image id when signed urls are enabled,
+// the result is used in place of the id when building the image url.
+// Expiry is aligned to the expire duration so that urls stay the same for a while and can be
+// cached by browsers, a signed url is valid for one to two expire durations.
+func SignImageId(id string) string {
+	if !config.Config.ImagesSignedUrls || id == "" {
+		return id
+	}
+
+	ttl := config.Config.ImagesUrlExpiresIn
+	expires := time.Now().Truncate(ttl).Add(2 * ttl).Unix()
+
+	return fmt.Sprintf("%s?expires=%d&signature=%s", id, expires, imageSignature(id, expires))
+}
+
+// VerifyImageSignature checks the signature produced by SignImageId.
+func VerifyImageSignature(id string, expiresStr string, signature string) bool {
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(imageSignature(id, expires)))
+}
+
+func imageSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(config.Config.ImagesSigningKey))
+	mac.Write([]byte(fmt.Sprintf("%s\n%d", id, expires)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
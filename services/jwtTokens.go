@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"log"
+	"math/big"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenTypeAccess grants access to the API
+	TokenTypeAccess = "access"
+	// TokenTypeTwoFactorChallenge is issued after the password check and only lets the user
+	// finish signing in with a second factor
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+)
+
+const (
+	JwtAlgorithmHS256 = "HS256"
+	JwtAlgorithmRS256 = "RS256"
+	JwtAlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	// SigningKeysCheckInterval is how often the keys are reloaded and rotated when due, a replica
+	// may keep signing with a key retired by another one for that long
+	SigningKeysCheckInterval = time.Hour
+	// signingKeysReloadInterval limits reloads caused by tokens signed with a key not seen yet,
+	// e.g. one just rotated by another replica
+	signingKeysReloadInterval = 10 * time.Second
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	TokenType string `json:"token_type"`
+	SessionId string `json:"sid,omitempty"`
+	// ProfileId is the viewer profile selected for the session, the default profile is used without it
+	ProfileId int `json:"pid,omitempty"`
+}
+
+func (c *TokenClaims) UserId() int {
+	userId, _ := strconv.Atoi(c.Subject)
+	return userId
+}
+
+// Jwk is a public key in the JSON Web Key format.
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+type signingKey struct {
+	id         string
+	method     jwt.SigningMethod
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+	isRetired  bool
+}
+
+// JwtService signs and verifies tokens. With an asymmetric algorithm the keys are stored in the
+// database and identified by the kid header, a new key is put in place every rotation interval
+// and the previous ones keep verifying tokens for the grace period. HS256 with the shared
+// secret is kept for existing deployments.
+type JwtService struct {
+	repo *repositories.SigningKeysRepository
+
+	mu         sync.RWMutex
+	keys       []signingKey
+	reloadedAt time.Time
+}
+
+func NewJwtService(repo *repositories.SigningKeysRepository) *JwtService {
+	return &JwtService{repo: repo}
+}
+
+func (s *JwtService) isSymmetric() bool {
+	return config.Config.JwtAlgorithm == JwtAlgorithmHS256
+}
+
+// Init makes sure a signing key exists and loads the keys, it has to be called before tokens are issued.
+func (s *JwtService) Init(c context.Context) error {
+	if s.isSymmetric() {
+		return nil
+	}
+
+	err := s.rotateIfDue(c)
+	if err != nil {
+		return err
+	}
+
+	return s.reload(c)
+}
+
+// StartRotation checks the keys in the background until the context is done.
+func (s *JwtService) StartRotation(c context.Context) {
+	if s.isSymmetric() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(SigningKeysCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+				err := s.Init(c)
+				if err != nil {
+					log.Printf("Failed to rotate signing keys: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *JwtService) rotateIfDue(c context.Context) error {
+	// Generating a key is expensive, so most checks end here. Rotate checks again under the lock
+	// in case another replica rotates in between
+	due, err := s.repo.IsRotationDue(c, config.Config.JwtAlgorithm, time.Now(), config.Config.JwtKeyRotationInterval)
+	if err != nil || !due {
+		return err
+	}
+
+	key, err := generateSigningKey(config.Config.JwtAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := s.repo.Rotate(c, key, config.Config.JwtKeyRotationInterval, config.Config.JwtKeyGracePeriod)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		log.Printf("Rotated signing keys, the new key is %s", key.Id)
+	}
+
+	return nil
+}
+
+func (s *JwtService) reload(c context.Context) error {
+	stored, err := s.repo.FindValid(c)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]signingKey, 0, len(stored))
+	for _, key := range stored {
+		parsed, err := parseSigningKey(key)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %s", key.Id, err)
+			continue
+		}
+		keys = append(keys, parsed)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.reloadedAt = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// currentKey returns the newest key which is not retired.
+func (s *JwtService) currentKey() (signingKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if !key.isRetired {
+			return key, true
+		}
+	}
+
+	return signingKey{}, false
+}
+
+func (s *JwtService) findKey(c context.Context, id string) (signingKey, bool) {
+	lookup := func() (signingKey, bool) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		for _, key := range s.keys {
+			if key.id == id {
+				return key, true
+			}
+		}
+		return signingKey{}, false
+	}
+
+	key, found := lookup()
+	if found {
+		return key, true
+	}
+
+	s.mu.RLock()
+	canReload := time.Since(s.reloadedAt) > signingKeysReloadInterval
+	s.mu.RUnlock()
+	if !canReload {
+		return signingKey{}, false
+	}
+
+	err := s.reload(c)
+	if err != nil {
+		log.Printf("Failed to reload signing keys: %s", err)
+		return signingKey{}, false
+	}
+
+	return lookup()
+}
+
+// IssueToken signs a token for the user, access tokens also carry the id of the session they belong to
+// and of the selected profile, if any.
+func (s *JwtService) IssueToken(userId int, sessionId string, profileId int, tokenType string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userId),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		TokenType: tokenType,
+		SessionId: sessionId,
+		ProfileId: profileId,
+	}
+
+	if s.isSymmetric() {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(config.Config.JwtSecretKey))
+	}
+
+	key, found := s.currentKey()
+	if !found {
+		return "", errors.New("no signing key available")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.privateKey)
+}
+
+// ParseToken validates the token and makes sure it was issued for the expected purpose.
+// Only the configured algorithm is accepted, the algorithm in the token header is never trusted.
+func (s *JwtService) ParseToken(c context.Context, tokenString string, tokenType string) (*TokenClaims, error) {
+	var claims TokenClaims
+	var token *jwt.Token
+	var err error
+	if s.isSymmetric() {
+		token, err = jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(config.Config.JwtSecretKey), nil
+		}, jwt.WithValidMethods([]string{JwtAlgorithmHS256}))
+	} else {
+		token, err = jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+			id, _ := token.Header["kid"].(string)
+			key, found := s.findKey(c, id)
+			// Keys of the previous algorithm stay valid during the grace period after switching
+			if !found || key.method.Alg() != token.Method.Alg() {
+				return nil, ErrInvalidToken
+			}
+			return key.publicKey, nil
+		}, jwt.WithValidMethods([]string{JwtAlgorithmRS256, JwtAlgorithmEdDSA}))
+	}
+	if err != nil || !token.Valid || claims.TokenType != tokenType {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+// Jwks returns the public keys which can verify tokens, so that other services don't need a secret.
+func (s *JwtService) Jwks() Jwks {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := Jwks{Keys: make([]Jwk, 0, len(s.keys))}
+	for _, key := range s.keys {
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, Jwk{
+				Kty: "RSA",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, Jwk{
+				Kty: "OKP",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	return jwks
+}
+
+func generateSigningKey(algorithm string) (models.SigningKey, error) {
+	var privateKey crypto.PrivateKey
+	var publicKey crypto.PublicKey
+	switch algorithm {
+	case JwtAlgorithmRS256:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		privateKey, publicKey = rsaKey, &rsaKey.PublicKey
+	case JwtAlgorithmEdDSA:
+		edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		privateKey, publicKey = edPrivateKey, edPublicKey
+	default:
+		return models.SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	privateDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		Id:         uuid.NewString(),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func parseSigningKey(key models.SigningKey) (signingKey, error) {
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil || key.Algorithm == JwtAlgorithmHS256 {
+		return signingKey{}, fmt.Errorf("unsupported signing algorithm %q", key.Algorithm)
+	}
+
+	privateBlock, _ := pem.Decode([]byte(key.PrivateKey))
+	publicBlock, _ := pem.Decode([]byte(key.PublicKey))
+	if privateBlock == nil || publicBlock == nil {
+		return signingKey{}, errors.New("invalid PEM")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	return signingKey{
+		id:         key.Id,
+		method:     method,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		isRetired:  key.RetiredAt != nil,
+	}, nil
+}
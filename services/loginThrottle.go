@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"strings"
+	"time"
+)
+
+// LoginThrottle slows down password guessing. Every failure doubles the delay before the next
+// attempt for both the account and the client IP, and the account is locked for a while once
+// it reaches the maximum number of failures. Counters live in the database so that all
+// replicas share them.
+//
+// An attempt is reserved before the password is checked and counts as a failure until it turns
+// out to be a success, so parallel guesses can't all get in before the first one is counted.
+type LoginThrottle struct {
+	repo *repositories.LoginAttemptsRepository
+}
+
+func NewLoginThrottle(repo *repositories.LoginAttemptsRepository) *LoginThrottle {
+	return &LoginThrottle{repo: repo}
+}
+
+// LoginAttempt is an attempt reserved with LoginThrottle.Reserve.
+type LoginAttempt struct {
+	account string
+	// ip is the IP counter before the attempt and ipReservedUntil the block the attempt put on it
+	ip              models.LoginAttempt
+	ipReservedUntil time.Time
+}
+
+// Reserve counts the attempt as a failure of the account and the client IP. It returns how long
+// the client has to wait before the next attempt instead when either of them is blocked.
+func (t *LoginThrottle) Reserve(c context.Context, email string, ip string) (LoginAttempt, time.Duration, error) {
+	// The database keeps microseconds, the moments are compared when the attempt is restored
+	now := time.Now().Truncate(time.Microsecond)
+	attempt := LoginAttempt{account: accountKey(email)}
+
+	before, reserved, err := t.repo.Reserve(c, []string{attempt.account, ipKey(ip)}, now, func(counter models.LoginAttempt) models.LoginAttempt {
+		if counter.LastFailureAt.Before(now.Add(-config.Config.LoginFailureWindow)) {
+			counter.Failures = 0
+		}
+		counter.Failures++
+		counter.LastFailureAt = now
+
+		delay := backoff(counter.Failures)
+		if counter.Key == attempt.account && counter.Failures >= config.Config.LoginMaxFailures {
+			delay = max(delay, config.Config.LoginLockoutDuration)
+		}
+		counter.BlockedUntil = now.Add(delay)
+
+		if counter.Key != attempt.account {
+			attempt.ipReservedUntil = counter.BlockedUntil
+		}
+		return counter
+	})
+	if err != nil {
+		return LoginAttempt{}, 0, err
+	}
+
+	if !reserved {
+		var blockedUntil time.Time
+		for _, counter := range before {
+			if counter.BlockedUntil.After(blockedUntil) {
+				blockedUntil = counter.BlockedUntil
+			}
+		}
+		return LoginAttempt{}, blockedUntil.Sub(now), nil
+	}
+
+	for _, counter := range before {
+		if counter.Key != attempt.account {
+			attempt.ip = counter
+		}
+	}
+
+	return attempt, 0, nil
+}
+
+// RegisterSuccess forgets the failures of the account and takes the attempt back from the IP
+// counter. The earlier failures of the IP are kept, otherwise signing in to one account would
+// allow to keep guessing passwords of others.
+func (t *LoginThrottle) RegisterSuccess(c context.Context, attempt LoginAttempt) error {
+	err := t.repo.Delete(c, attempt.account)
+	if err != nil {
+		return err
+	}
+
+	return t.repo.Restore(c, attempt.ip, attempt.ipReservedUntil)
+}
+
+// StartCleanup periodically removes the counters of accounts and IPs which stopped failing until the context
+// is done, otherwise every email and IP ever tried would stay in the table.
+func (t *LoginThrottle) StartCleanup(c context.Context) {
+	startPeriodicJob(c, "clean up sign in attempts", config.Config.LoginFailureWindow, func(c context.Context) error {
+		now := time.Now()
+		return t.repo.DeleteExpired(c, now, now.Add(-config.Config.LoginFailureWindow))
+	})
+}
+
+func backoff(failures int) time.Duration {
+	delay := config.Config.LoginBackoffBase
+	for i := 1; i < failures && delay < config.Config.LoginBackoffMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, config.Config.LoginBackoffMax)
+}
+
+func accountKey(email string) string {
+	return fmt.Sprintf("email:%s", strings.ToLower(strings.TrimSpace(email)))
+}
+
+func ipKey(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+// ParentalPinAccount is the account name guesses of the parental PIN are throttled under,
+// it can't clash with an email.
+func ParentalPinAccount(userId int) string {
+	return fmt.Sprintf("parental-pin:%d", userId)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"time"
+)
+
+// mailIpWindow is the period MAIL_MAX_PER_IP_HOURLY counts the emails of a client IP over
+const mailIpWindow = time.Hour
+
+// MailThrottle limits the emails anyone can make the API send, so that the forms sending them
+// can't flood a mailbox. An address gets at most one email every MAIL_RESEND_INTERVAL and a client IP
+// may ask for MAIL_MAX_PER_IP_HOURLY emails an hour. Counters share the table of the sign in throttle.
+type MailThrottle struct {
+	repo *repositories.LoginAttemptsRepository
+}
+
+func NewMailThrottle(repo *repositories.LoginAttemptsRepository) *MailThrottle {
+	return &MailThrottle{repo: repo}
+}
+
+// Reserve counts an email to the address requested by the client IP. It returns how long the client
+// has to wait instead when either of them has reached the limit.
+func (t *MailThrottle) Reserve(c context.Context, email string, ip string) (time.Duration, error) {
+	now := time.Now().Truncate(time.Microsecond)
+	emailKey := fmt.Sprintf("mail:%s", NormalizeEmail(email))
+
+	before, reserved, err := t.repo.Reserve(c, []string{emailKey, fmt.Sprintf("mail-ip:%s", ip)}, now, func(counter models.LoginAttempt) models.LoginAttempt {
+		if counter.Key == emailKey {
+			counter.Failures++
+			counter.LastFailureAt = now
+			counter.BlockedUntil = now.Add(config.Config.MailResendInterval)
+			return counter
+		}
+
+		// The last failure is the start of the window for the IP
+		if counter.Failures == 0 || counter.LastFailureAt.Before(now.Add(-mailIpWindow)) {
+			counter.Failures = 0
+			counter.LastFailureAt = now
+		}
+		counter.Failures++
+		counter.BlockedUntil = now
+		if counter.Failures >= config.Config.MailMaxPerIpHourly {
+			counter.BlockedUntil = counter.LastFailureAt.Add(mailIpWindow)
+		}
+		return counter
+	})
+	if err != nil || reserved {
+		return 0, err
+	}
+
+	var blockedUntil time.Time
+	for _, counter := range before {
+		if counter.BlockedUntil.After(blockedUntil) {
+			blockedUntil = counter.BlockedUntil
+		}
+	}
+	return blockedUntil.Sub(now), nil
+}
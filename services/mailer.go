@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"ozinshe-final-project/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer picks the mailer configured by MAILER: "smtp" sends real emails,
+// anything else writes them to MAILER_LOG_FILE or to the log for local testing.
+func NewMailer() Mailer {
+	if config.Config.Mailer == "smtp" {
+		return &SmtpMailer{
+			host:     config.Config.SmtpHost,
+			port:     config.Config.SmtpPort,
+			username: config.Config.SmtpUsername,
+			password: config.Config.SmtpPassword,
+			from:     config.Config.MailFrom,
+		}
+	}
+
+	return &LogMailer{path: config.Config.MailerLogFile, from: config.Config.MailFrom}
+}
+
+type SmtpMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func (m *SmtpMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.host, m.port)
+	return smtp.SendMail(addr, auth, m.from, []string{to}, buildMessage(m.from, to, subject, body))
+}
+
+type LogMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	message := buildMessage(m.from, to, subject, body)
+	if m.path == "" {
+		log.Printf("Email to %s:\n%s", to, message)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\n%s\n\n", time.Now().Format(time.RFC3339), message)
+	return err
+}
+
+func buildMessage(from string, to string, subject string, body string) []byte {
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(body)
+
+	return []byte(message.String())
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"slices"
+	"time"
+)
+
+// neutralRating splits the ratings into likes above it and dislikes below it
+const neutralRating = 3
+
+// minCommonRaters is how many profiles have to rate both movies for them to become neighbours
+const minCommonRaters = 2
+
+// NeighboursService precomputes "people who liked this also liked" neighbours of the movies
+// from the ratings of all profiles.
+type NeighboursService struct {
+	repo *repositories.MovieNeighboursRepository
+}
+
+func NewNeighboursService(repo *repositories.MovieNeighboursRepository) *NeighboursService {
+	return &NeighboursService{repo: repo}
+}
+
+// Refresh recomputes the neighbours of every movie and returns how many were stored.
+func (s *NeighboursService) Refresh(c context.Context) (int, error) {
+	ratings, err := s.repo.FindRatings(c)
+	if err != nil {
+		return 0, err
+	}
+
+	neighbours := ComputeNeighbours(ratings, config.Config.RecommendationsNeighbours)
+	stored, err := s.repo.Replace(c, neighbours, time.Now())
+	if err != nil || !stored {
+		return 0, err
+	}
+
+	return len(neighbours), nil
+}
+
+// StartRefresh recomputes the neighbours right away and then periodically until the context is done.
+func (s *NeighboursService) StartRefresh(c context.Context) {
+	startPeriodicJob(c, "refresh movie neighbours", config.Config.RecommendationsRefreshInterval, func(c context.Context) error {
+		_, err := s.Refresh(c)
+		return err
+	})
+}
+
+// ComputeNeighbours builds the item-item similarity matrix of the movies and keeps the k closest
+// neighbours of each. Movies are compared by the cosine of their rating vectors, ratings centred on
+// the neutral one so that a like and a dislike pull the movies apart.
+func ComputeNeighbours(ratings []models.MovieRating, k int) []models.MovieNeighbour {
+	type pair struct {
+		a, b int
+	}
+
+	byProfile := make(map[int][]models.MovieRating)
+	norms := make(map[int]float64)
+	for _, rating := range ratings {
+		byProfile[rating.ProfileId] = append(byProfile[rating.ProfileId], rating)
+		centred := float64(rating.Rating - neutralRating)
+		norms[rating.MovieId] += centred * centred
+	}
+
+	dots := make(map[pair]float64)
+	commonRaters := make(map[pair]int)
+	for _, profileRatings := range byProfile {
+		for i, x := range profileRatings {
+			for _, y := range profileRatings[i+1:] {
+				key := pair{min(x.MovieId, y.MovieId), max(x.MovieId, y.MovieId)}
+				dots[key] += float64(x.Rating-neutralRating) * float64(y.Rating-neutralRating)
+				commonRaters[key]++
+			}
+		}
+	}
+
+	byMovie := make(map[int][]models.MovieNeighbour)
+	for key, dot := range dots {
+		if commonRaters[key] < minCommonRaters || dot <= 0 {
+			continue
+		}
+
+		score := dot / math.Sqrt(norms[key.a]*norms[key.b])
+		byMovie[key.a] = append(byMovie[key.a], models.MovieNeighbour{MovieId: key.a, NeighbourId: key.b, Score: score})
+		byMovie[key.b] = append(byMovie[key.b], models.MovieNeighbour{MovieId: key.b, NeighbourId: key.a, Score: score})
+	}
+
+	neighbours := make([]models.MovieNeighbour, 0)
+	for _, movieNeighbours := range byMovie {
+		slices.SortFunc(movieNeighbours, func(a, b models.MovieNeighbour) int {
+			return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.NeighbourId, b.NeighbourId))
+		})
+		neighbours = append(neighbours, movieNeighbours[:min(k, len(movieNeighbours))]...)
+	}
+
+	return neighbours
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"cmp"
+	"math"
+	"ozinshe-final-project/models"
+	"slices"
+	"testing"
+)
+
+func TestComputeNeighbours(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings []models.MovieRating
+		k       int
+		want    []models.MovieNeighbour
+	}{
+		{
+			name: "liked by the same profiles",
+			ratings: []models.MovieRating{
+				{ProfileId: 1, MovieId: 1, Rating: 5},
+				{ProfileId: 1, MovieId: 2, Rating: 4},
+				{ProfileId: 2, MovieId: 1, Rating: 4},
+				{ProfileId: 2, MovieId: 2, Rating: 5},
+			},
+			k: 5,
+			want: []models.MovieNeighbour{
+				{MovieId: 1, NeighbourId: 2, Score: 0.8},
+				{MovieId: 2, NeighbourId: 1, Score: 0.8},
+			},
+		},
+		{
+			name: "single common rater",
+			ratings: []models.MovieRating{
+				{ProfileId: 1, MovieId: 1, Rating: 5},
+				{ProfileId: 1, MovieId: 2, Rating: 5},
+				{ProfileId: 2, MovieId: 1, Rating: 5},
+			},
+			k:    5,
+			want: []models.MovieNeighbour{},
+		},
+		{
+			name: "liked and disliked",
+			ratings: []models.MovieRating{
+				{ProfileId: 1, MovieId: 1, Rating: 5},
+				{ProfileId: 1, MovieId: 2, Rating: 1},
+				{ProfileId: 2, MovieId: 1, Rating: 4},
+				{ProfileId: 2, MovieId: 2, Rating: 2},
+			},
+			k:    5,
+			want: []models.MovieNeighbour{},
+		},
+		{
+			name: "neutral ratings",
+			ratings: []models.MovieRating{
+				{ProfileId: 1, MovieId: 1, Rating: 3},
+				{ProfileId: 1, MovieId: 2, Rating: 5},
+				{ProfileId: 2, MovieId: 1, Rating: 3},
+				{ProfileId: 2, MovieId: 2, Rating: 5},
+			},
+			k:    5,
+			want: []models.MovieNeighbour{},
+		},
+		{
+			name: "closest k kept",
+			ratings: []models.MovieRating{
+				{ProfileId: 1, MovieId: 1, Rating: 5},
+				{ProfileId: 1, MovieId: 2, Rating: 5},
+				{ProfileId: 1, MovieId: 3, Rating: 4},
+				{ProfileId: 2, MovieId: 1, Rating: 5},
+				{ProfileId: 2, MovieId: 2, Rating: 5},
+				{ProfileId: 2, MovieId: 3, Rating: 5},
+			},
+			k: 1,
+			want: []models.MovieNeighbour{
+				{MovieId: 1, NeighbourId: 2, Score: 1},
+				{MovieId: 2, NeighbourId: 1, Score: 1},
+				// Movies 1 and 2 are equally close to movie 3, the lower id wins
+				{MovieId: 3, NeighbourId: 1, Score: 6 / math.Sqrt(40)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ComputeNeighbours(test.ratings, test.k)
+			slices.SortFunc(got, func(a, b models.MovieNeighbour) int {
+				return cmp.Or(cmp.Compare(a.MovieId, b.MovieId), cmp.Compare(a.NeighbourId, b.NeighbourId))
+			})
+
+			equal := slices.EqualFunc(got, test.want, func(a, b models.MovieNeighbour) bool {
+				return a.MovieId == b.MovieId && a.NeighbourId == b.NeighbourId && math.Abs(a.Score-b.Score) < 1e-9
+			})
+			if !equal {
+				t.Errorf("ComputeNeighbours() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
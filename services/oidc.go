@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/url"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcStateTtl           = 10 * time.Minute
+	oidcDiscoveryTtl       = time.Hour
+	oidcJwksReloadInterval = time.Minute
+)
+
+var (
+	ErrOidcInvalidState = errors.New("invalid or expired login state")
+	ErrOidcInvalidToken = errors.New("invalid id token")
+)
+
+// OidcIdentity is what the identity provider tells about the signed in user.
+type OidcIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Roles         []string
+	// HasRoles tells a missing roles claim from an empty one
+	HasRoles bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IdToken string `json:"id_token"`
+}
+
+// OidcService signs users in with an OpenID Connect provider using the authorization code flow with PKCE.
+// The provider endpoints come from its discovery document and the id token is verified with its published keys.
+type OidcService struct {
+	statesRepo *repositories.OidcStatesRepository
+	client     *http.Client
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	keys         map[string]crypto.PublicKey
+	keysLoadedAt time.Time
+}
+
+func NewOidcService(statesRepo *repositories.OidcStatesRepository) *OidcService {
+	return &OidcService{
+		statesRepo: statesRepo,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthorizationUrl starts a login and returns the url of the identity provider to redirect the user to.
+func (s *OidcService) AuthorizationUrl(c context.Context) (string, error) {
+	discovery, err := s.getDiscovery(c)
+	if err != nil {
+		return "", err
+	}
+
+	state, stateHash, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, _, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, _, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.statesRepo.Create(c, models.OidcLoginState{
+		StateHash:    stateHash,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcStateTtl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.Config.OidcClientId},
+		"redirect_uri":          {config.Config.OidcRedirectUrl},
+		"scope":                 {config.Config.OidcScopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange finishes the login started with AuthorizationUrl and returns the verified identity.
+func (s *OidcService) Exchange(c context.Context, state string, code string) (OidcIdentity, error) {
+	loginState, err := s.statesRepo.Consume(c, HashSecureToken(state))
+	if err != nil {
+		return OidcIdentity{}, ErrOidcInvalidState
+	}
+
+	discovery, err := s.getDiscovery(c)
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.Config.OidcRedirectUrl},
+		"client_id":     {config.Config.OidcClientId},
+		"code_verifier": {loginState.CodeVerifier},
+	}
+	request, err := http.NewRequestWithContext(c, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if config.Config.OidcClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(config.Config.OidcClientId), url.QueryEscape(config.Config.OidcClientSecret))
+	}
+
+	var tokenResponse oidcTokenResponse
+	err = s.doJson(request, &tokenResponse)
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+
+	return s.verifyIdToken(c, discovery, tokenResponse.IdToken, loginState.Nonce)
+}
+
+func (s *OidcService) verifyIdToken(c context.Context, discovery *oidcDiscovery, idToken string, nonce string) (OidcIdentity, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		return s.findKey(c, discovery, id)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(config.Config.OidcClientId),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return OidcIdentity{}, ErrOidcInvalidToken
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return OidcIdentity{}, ErrOidcInvalidToken
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return OidcIdentity{}, ErrOidcInvalidToken
+	}
+
+	rolesClaim, hasRoles := claims[config.Config.OidcRolesClaim]
+	identity := OidcIdentity{
+		Issuer:   discovery.Issuer,
+		Subject:  subject,
+		Roles:    stringsClaim(rolesClaim),
+		HasRoles: hasRoles,
+	}
+	email, _ := claims["email"].(string)
+	identity.Email = NormalizeEmail(email)
+	identity.Name, _ = claims["name"].(string)
+
+	// Some providers send the flag as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity, nil
+}
+
+// MapOidcRole picks the highest role granted by the roles or groups of the identity. It returns false
+// when the role can't be told, i.e. the provider has not sent the roles claim or no roles are mapped.
+func MapOidcRole(identity OidcIdentity) (string, bool) {
+	if !identity.HasRoles || (strings.TrimSpace(config.Config.OidcAdminRoles) == "" && strings.TrimSpace(config.Config.OidcEditorRoles) == "") {
+		return "", false
+	}
+
+	matches := func(configured string) bool {
+		for _, role := range strings.Split(configured, ",") {
+			role = strings.TrimSpace(role)
+			if role != "" && slices.Contains(identity.Roles, role) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if matches(config.Config.OidcAdminRoles) {
+		return models.RoleAdmin, true
+	}
+	if matches(config.Config.OidcEditorRoles) {
+		return models.RoleEditor, true
+	}
+
+	return models.RoleUser, true
+}
+
+func (s *OidcService) getDiscovery(c context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil && time.Since(s.discoveredAt) < oidcDiscoveryTtl {
+		return s.discovery, nil
+	}
+
+	discoveryUrl := config.Config.OidcDiscoveryUrl
+	if discoveryUrl == "" {
+		discoveryUrl = strings.TrimSuffix(config.Config.OidcIssuerUrl, "/") + "/.well-known/openid-configuration"
+	}
+
+	request, err := http.NewRequestWithContext(c, http.MethodGet, discoveryUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery oidcDiscovery
+	err = s.doJson(request, &discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(config.Config.OidcIssuerUrl, "/") {
+		return nil, fmt.Errorf("discovery document is issued by %q, expected %q", discovery.Issuer, config.Config.OidcIssuerUrl)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksUri == "" {
+		return nil, errors.New("discovery document is incomplete")
+	}
+
+	s.discovery = &discovery
+	s.discoveredAt = time.Now()
+
+	return s.discovery, nil
+}
+
+// findKey returns the provider key with the id, the keys are reloaded when an unknown one is requested
+// since the provider may have rotated them.
+func (s *OidcService) findKey(c context.Context, discovery *oidcDiscovery, id string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, found := s.keys[id]
+	if found {
+		return key, nil
+	}
+	if time.Since(s.keysLoadedAt) < oidcJwksReloadInterval {
+		return nil, ErrOidcInvalidToken
+	}
+
+	request, err := http.NewRequestWithContext(c, http.MethodGet, discovery.JwksUri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks Jwks
+	err = s.doJson(request, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := parseJwk(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+
+	s.keys = keys
+	s.keysLoadedAt = time.Now()
+
+	key, found = s.keys[id]
+	if !found {
+		return nil, ErrOidcInvalidToken
+	}
+
+	return key, nil
+}
+
+func (s *OidcService) doJson(request *http.Request, target any) error {
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s responded with %s", request.Method, request.URL, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func parseJwk(jwk Jwk) (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		bytes, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(bytes), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// stringsClaim accepts both a single value and a list, providers differ in how they send groups.
+func stringsClaim(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(value, ",", " "))
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
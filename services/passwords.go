@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"os"
+	"ozinshe-final-project/config"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+// passwordMaxLength is the longest password in bytes bcrypt can hash without truncating it
+const passwordMaxLength = 72
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordPolicyError explains why a password was rejected, the message is meant for the user.
+type PasswordPolicyError struct {
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+var (
+	breachedPasswords     map[string]struct{}
+	breachedPasswordsOnce sync.Once
+)
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// ValidatePassword checks the password against the configured policy.
+func ValidatePassword(password string, email string) error {
+	if utf8.RuneCountInString(password) < config.Config.PasswordMinLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at least %d characters long", config.Config.PasswordMinLength)}
+	}
+	if len(password) > passwordMaxLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at most %d bytes long", passwordMaxLength)}
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(password))
+	email = strings.ToLower(strings.TrimSpace(email))
+	localPart, _, _ := strings.Cut(email, "@")
+	if email != "" && (normalized == email || normalized == localPart) {
+		return &PasswordPolicyError{"Password must not be the same as the email"}
+	}
+
+	if isBreachedPassword(normalized) {
+		return &PasswordPolicyError{"Password is too common, it appears in known data breaches"}
+	}
+
+	return nil
+}
+
+// isBreachedPassword looks the password up in the local list of leaked passwords, one password per line.
+func isBreachedPassword(normalized string) bool {
+	breachedPasswordsOnce.Do(func() {
+		breachedPasswords = make(map[string]struct{})
+		if config.Config.PasswordBreachedListFile == "" {
+			return
+		}
+
+		file, err := os.Open(config.Config.PasswordBreachedListFile)
+		if err != nil {
+			log.Printf("Breached passwords list is not loaded: %s", err)
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if line != "" && !strings.HasPrefix(line, "#") {
+				breachedPasswords[line] = struct{}{}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("Breached passwords list is only partially loaded: %s", err)
+		}
+	})
+
+	_, found := breachedPasswords[normalized]
+	return found
+}
+
+// HashPassword hashes the password with the configured algorithm. Argon2id hashes use the PHC string format.
+func HashPassword(password string) (string, error) {
+	if config.Config.PasswordHashAlgorithm == PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), config.Config.PasswordBcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	memory, iterations, parallelism := argon2Params()
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		memory,
+		iterations,
+		parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword compares the password with the stored hash. When it matches, needsRehash tells whether
+// the hash was made with another algorithm or weaker parameters than configured now, so it should be replaced.
+func VerifyPassword(hash string, password string) (matches bool, needsRehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		var version int
+		var memory, iterations uint32
+		var parallelism uint8
+		parts := strings.Split(hash, "$")
+		if len(parts) != 6 {
+			return false, false
+		}
+		_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+		if err != nil || version != argon2.Version {
+			return false, false
+		}
+		_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism)
+		if err != nil {
+			return false, false
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, false
+		}
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, false
+		}
+
+		actual := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false
+		}
+
+		wantMemory, wantIterations, wantParallelism := argon2Params()
+		return true, config.Config.PasswordHashAlgorithm != PasswordHashArgon2id ||
+			memory != wantMemory || iterations != wantIterations || parallelism != wantParallelism
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || config.Config.PasswordHashAlgorithm != PasswordHashBcrypt || cost != config.Config.PasswordBcryptCost
+}
+
+// VerifyDummyPassword takes as long as checking the password of an existing user, so that the response
+// time doesn't tell whether an account exists.
+func VerifyDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		var err error
+		dummyPasswordHash, err = HashPassword("dummy password")
+		if err != nil {
+			log.Printf("Failed to hash the dummy password: %s", err)
+		}
+	})
+
+	VerifyPassword(dummyPasswordHash, password)
+}
+
+func argon2Params() (uint32, uint32, uint8) {
+	return uint32(config.Config.PasswordArgon2Memory), uint32(config.Config.PasswordArgon2Iterations), uint8(config.Config.PasswordArgon2Parallelism)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"ozinshe-final-project/config"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	argon2id := config.MapConfig{
+		PasswordHashAlgorithm:     PasswordHashArgon2id,
+		PasswordArgon2Memory:      64,
+		PasswordArgon2Iterations:  1,
+		PasswordArgon2Parallelism: 1,
+		PasswordBcryptCost:        bcrypt.MinCost,
+	}
+	strongerArgon2id := argon2id
+	strongerArgon2id.PasswordArgon2Memory = 128
+	moreArgon2idIterations := argon2id
+	moreArgon2idIterations.PasswordArgon2Iterations = 2
+	bcryptConfig := argon2id
+	bcryptConfig.PasswordHashAlgorithm = PasswordHashBcrypt
+	strongerBcrypt := bcryptConfig
+	strongerBcrypt.PasswordBcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name            string
+		hashedWith      config.MapConfig
+		verifiedWith    config.MapConfig
+		password        string
+		wantMatches     bool
+		wantNeedsRehash bool
+	}{
+		{"argon2id up to date", argon2id, argon2id, "correct horse", true, false},
+		{"argon2id with less memory", argon2id, strongerArgon2id, "correct horse", true, true},
+		{"argon2id with fewer iterations", argon2id, moreArgon2idIterations, "correct horse", true, true},
+		{"argon2id after switching to bcrypt", argon2id, bcryptConfig, "correct horse", true, true},
+		{"argon2id wrong password", argon2id, strongerArgon2id, "battery staple", false, false},
+		{"bcrypt up to date", bcryptConfig, bcryptConfig, "correct horse", true, false},
+		{"bcrypt with lower cost", bcryptConfig, strongerBcrypt, "correct horse", true, true},
+		{"bcrypt after switching to argon2id", bcryptConfig, argon2id, "correct horse", true, true},
+		{"bcrypt wrong password", bcryptConfig, argon2id, "battery staple", false, false},
+	}
+
+	previous := config.Config
+	defer func() { config.Config = previous }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Config = &test.hashedWith
+			hash, err := HashPassword("correct horse")
+			if err != nil {
+				t.Fatalf("HashPassword() error = %s", err)
+			}
+
+			config.Config = &test.verifiedWith
+			matches, needsRehash := VerifyPassword(hash, test.password)
+			if matches != test.wantMatches || needsRehash != test.wantNeedsRehash {
+				t.Errorf("VerifyPassword() = %t, %t, want %t, %t", matches, needsRehash, test.wantMatches, test.wantNeedsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// startPeriodicJob runs the job right away and then every interval until the context is done,
+// logging its failures, name says what the job does e.g. "refresh movie popularity".
+func startPeriodicJob(c context.Context, name string, interval time.Duration, job func(c context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			err := job(c)
+			if err != nil {
+				log.Printf("Failed to %s: %s", name, err)
+			}
+
+			select {
+			case <-c.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"ozinshe-final-project/config"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"time"
+)
+
+// PopularityService keeps the decayed popularity scores of the movies up to date.
+type PopularityService struct {
+	repo *repositories.MovieEventsRepository
+}
+
+func NewPopularityService(repo *repositories.MovieEventsRepository) *PopularityService {
+	return &PopularityService{repo: repo}
+}
+
+// StartRefresh recomputes the popularity right away and then periodically until the context is done.
+func (s *PopularityService) StartRefresh(c context.Context) {
+	startPeriodicJob(c, "refresh movie popularity", config.Config.PopularityRefreshInterval, func(c context.Context) error {
+		_, err := s.repo.RefreshPopularity(c, models.PopularityWindows, time.Now())
+		return err
+	})
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"ozinshe-final-project/models"
+	"ozinshe-final-project/repositories"
+	"path/filepath"
+	"strings"
+)
+
+const ImagesDir = "images"
+
+// MaxImageMegapixels keeps a small file declaring huge dimensions from exhausting the memory when decoded
+const MaxImageMegapixels = 50
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	ErrImageTooLarge    = errors.New("image dimensions are too large")
+)
+
+// PostersService stores uploaded images under the hash of their content, so identical
+// uploads share a single file which is only removed once nothing refers to it.
+type PostersService struct {
+	imagesRepo *repositories.ImagesRepository
+}
+
+func NewPostersService(imagesRepo *repositories.ImagesRepository) *PostersService {
+	return &PostersService{imagesRepo: imagesRepo}
+}
+
+func (s *PostersService) FindByHash(c context.Context, hash string) (models.Image, error) {
+	return s.imagesRepo.FindByHash(c, strings.ToLower(hash))
+}
+
+// Save stores the uploaded file and returns the id of the image to refer to.
+func (s *PostersService) Save(c context.Context, fileHeader *multipart.FileHeader) (string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	// Written while the image record is locked, a concurrent release may have just removed the file
+	store := func(id string) error {
+		return s.writeFile(id, content)
+	}
+
+	existing, err := s.imagesRepo.FindByHash(c, hash)
+	if err == nil {
+		return s.imagesRepo.AddReference(c, existing, store)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	id := fmt.Sprintf("%s%s", hash, strings.ToLower(filepath.Ext(fileHeader.Filename)))
+	image, err := describeImage(id, content)
+	if err != nil {
+		return "", err
+	}
+
+	// The same content may have been stored concurrently under another extension, then the file goes under that id
+	return s.imagesRepo.AddReference(c, image, store)
+}
+
+// SaveByHash refers to an already uploaded image without sending its content again.
+func (s *PostersService) SaveByHash(c context.Context, hash string) (string, error) {
+	image, err := s.FindByHash(c, hash)
+	if err != nil {
+		return "", err
+	}
+
+	found, err := s.imagesRepo.Retain(c, image.Id)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		// Released since it was found
+		return "", pgx.ErrNoRows
+	}
+
+	return image.Id, nil
+}
+
+// Retain adds one more reference to an image which is already stored.
+func (s *PostersService) Retain(c context.Context, id string) error {
+	// Images stored before uploads were tracked are never released, so nothing to count for them
+	_, err := s.imagesRepo.Retain(c, id)
+	return err
+}
+
+// Release drops one reference to the image and deletes the file once it is no longer used.
+func (s *PostersService) Release(c context.Context, id string) error {
+	_, err := s.imagesRepo.RemoveReference(c, id, func() error {
+		err := os.Remove(GetImagePath(id))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+// Backfill computes the metadata of every image already present in the images directory,
+// registering files which were stored before uploads were tracked.
+func (s *PostersService) Backfill(c context.Context) (int, error) {
+	entries, err := os.ReadDir(ImagesDir)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || strings.HasPrefix(entry.Name(), "upload-") {
+			continue
+		}
+
+		content, err := os.ReadFile(GetImagePath(entry.Name()))
+		if err != nil {
+			return processed, err
+		}
+
+		image, err := describeImage(entry.Name(), content)
+		if err != nil {
+			log.Printf("Skipping %s: %s", entry.Name(), err)
+			continue
+		}
+
+		storedId, err := s.imagesRepo.Upsert(c, image)
+		if err != nil {
+			return processed, err
+		}
+		if storedId != image.Id {
+			log.Printf("Merged %s into %s: the same content is already stored under that name", entry.Name(), storedId)
+			err = os.Remove(GetImagePath(entry.Name()))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return processed, err
+			}
+		}
+
+		processed++
+	}
+
+	return processed, nil
+}
+
+func describeImage(id string, content []byte) (models.Image, error) {
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return models.Image{}, ErrUnsupportedImage
+	}
+	if int64(imageConfig.Width)*int64(imageConfig.Height) > MaxImageMegapixels*1_000_000 {
+		return models.Image{}, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return models.Image{}, ErrUnsupportedImage
+	}
+
+	sum := sha256.Sum256(content)
+
+	return models.Image{
+		Id:            id,
+		Hash:          hex.EncodeToString(sum[:]),
+		ContentType:   http.DetectContentType(content),
+		Size:          int64(len(content)),
+		Blurhash:      EncodeBlurhash(decoded),
+		DominantColor: DominantColor(decoded),
+	}, nil
+}
+
+func (s *PostersService) writeFile(id string, content []byte) error {
+	path := GetImagePath(id)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(ImagesDir, "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func GetImagePath(id string) string {
+	return fmt.Sprintf("%s/%s", ImagesDir, id)
+}
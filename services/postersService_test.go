@@ -0,0 +1,50 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// pngDeclaring encodes a 1×1 PNG and rewrites its header to declare the dimensions, the pixel data stays tiny.
+func pngDeclaring(t *testing.T, width uint32, height uint32) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatalf("png.Encode() error = %s", err)
+	}
+
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height, ..., crc over type and data
+	content := buf.Bytes()
+	binary.BigEndian.PutUint32(content[16:20], width)
+	binary.BigEndian.PutUint32(content[20:24], height)
+	binary.BigEndian.PutUint32(content[29:33], crc32.ChecksumIEEE(content[12:29]))
+
+	return content
+}
+
+func TestDescribeImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"small", pngDeclaring(t, 1, 1), nil},
+		{"huge dimensions", pngDeclaring(t, 100_000, 100_000), ErrImageTooLarge},
+		{"just over the limit", pngDeclaring(t, MaxImageMegapixels*1_000_000+1, 1), ErrImageTooLarge},
+		{"not an image", []byte("hello"), ErrUnsupportedImage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := describeImage("poster.png", test.content)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("describeImage() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"cmp"
+	"ozinshe-final-project/models"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Weights of the signals two movies are compared by
+const (
+	sharedGenreWeight = 3.0
+	directorWeight    = 2.0
+	eraWeight         = 1.5
+	keywordWeight     = 4.0
+)
+
+// eraSpan is the difference in release years after which the era stops counting
+const eraSpan = 20
+
+// keywordStemLength cuts words to a common stem so that inflected forms match, e.g. «аристократ» and «аристократа»
+const keywordStemLength = 6
+
+const minKeywordLength = 4
+
+// HighRating is the lowest rating which counts as liking the movie
+const HighRating = 4
+
+var stopWords = map[string]bool{
+	"that": true, "this": true, "with": true, "from": true, "they": true, "their": true, "when": true,
+	"which": true, "what": true, "into": true, "have": true, "will": true, "after": true, "about": true,
+	"также": true, "чтобы": true, "когда": true, "который": true, "которая": true, "которые": true,
+	"после": true, "этого": true, "этой": true, "только": true, "несмотря": true, "будет": true,
+	"может": true, "время": true, "своей": true, "своего": true, "свою": true, "более": true,
+}
+
+// SimilarMovies ranks the candidates by how similar they are to the movie. Candidates with nothing
+// in common are left out, as is the movie itself.
+func SimilarMovies(movie models.Movie, candidates []models.Movie) []models.Movie {
+	features := movieFeatures(movie)
+	scores := make(map[int]float64, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Id == movie.Id {
+			continue
+		}
+		scores[candidate.Id] = similarity(features, movieFeatures(candidate))
+	}
+
+	return rankMovies(candidates, scores)
+}
+
+// RecommendMovies builds a taste profile from the movies the profile rated high or watched and
+// ranks the movies it hasn't watched yet by their similarity to them. The movies carry the rating
+// and the watched state of the profile, as returned by MoviesRepository.FindAll.
+func RecommendMovies(movies []models.Movie) []models.Movie {
+	type seed struct {
+		features features
+		weight   float64
+	}
+
+	seeds := make([]seed, 0)
+	for _, movie := range movies {
+		weight := tasteWeight(movie)
+		if weight > 0 {
+			seeds = append(seeds, seed{features: movieFeatures(movie), weight: weight})
+		}
+	}
+
+	scores := make(map[int]float64)
+	for _, candidate := range movies {
+		if candidate.IsWatched || candidate.Rating > 0 {
+			continue
+		}
+
+		candidateFeatures := movieFeatures(candidate)
+		for _, s := range seeds {
+			scores[candidate.Id] += s.weight * similarity(s.features, candidateFeatures)
+		}
+	}
+
+	return rankMovies(movies, scores)
+}
+
+// TasteMovieIds returns the movies which make up the taste of the profile, see RecommendMovies.
+func TasteMovieIds(movies []models.Movie) []int {
+	ids := make([]int, 0)
+	for _, movie := range movies {
+		if tasteWeight(movie) > 0 {
+			ids = append(ids, movie.Id)
+		}
+	}
+
+	return ids
+}
+
+// AlsoLikedMovies ranks the candidates by the precomputed neighbours of the movie.
+func AlsoLikedMovies(movie models.Movie, candidates []models.Movie, neighbours []models.MovieNeighbour) []models.Movie {
+	scores := make(map[int]float64)
+	for _, neighbour := range neighbours {
+		if neighbour.MovieId == movie.Id && neighbour.NeighbourId != movie.Id {
+			scores[neighbour.NeighbourId] += neighbour.Score
+		}
+	}
+
+	return rankMovies(candidates, scores)
+}
+
+// CollaborativeRecommendations ranks the movies the profile hasn't watched yet by the precomputed
+// neighbours of the movies making up its taste, weighted like in RecommendMovies.
+func CollaborativeRecommendations(movies []models.Movie, neighbours []models.MovieNeighbour) []models.Movie {
+	weights := make(map[int]float64, len(movies))
+	for _, movie := range movies {
+		weights[movie.Id] = tasteWeight(movie)
+	}
+
+	scores := make(map[int]float64)
+	for _, neighbour := range neighbours {
+		scores[neighbour.NeighbourId] += weights[neighbour.MovieId] * neighbour.Score
+	}
+
+	for _, movie := range movies {
+		if movie.IsWatched || movie.Rating > 0 {
+			delete(scores, movie.Id)
+		}
+	}
+
+	return rankMovies(movies, scores)
+}
+
+// MergeRankings appends the movies of the fallback ranking which are missing from the primary one.
+func MergeRankings(primary []models.Movie, fallback []models.Movie) []models.Movie {
+	seen := make(map[int]bool, len(primary))
+	for _, movie := range primary {
+		seen[movie.Id] = true
+	}
+
+	merged := slices.Clone(primary)
+	for _, movie := range fallback {
+		if !seen[movie.Id] {
+			merged = append(merged, movie)
+		}
+	}
+
+	return merged
+}
+
+// tasteWeight is how much the movie tells about the taste of the profile, movies rated low tell nothing.
+func tasteWeight(movie models.Movie) float64 {
+	switch {
+	case movie.Rating >= HighRating:
+		return float64(movie.Rating - HighRating + 2)
+	case movie.Rating > 0:
+		return 0
+	case movie.IsWatched:
+		return 1
+	}
+
+	return 0
+}
+
+type features struct {
+	genres      map[int]bool
+	director    string
+	releaseYear int
+	keywords    map[string]bool
+}
+
+func movieFeatures(movie models.Movie) features {
+	f := features{
+		genres:      make(map[int]bool, len(movie.Genres)),
+		director:    strings.ToLower(strings.TrimSpace(movie.Director)),
+		releaseYear: movie.ReleaseYear,
+		keywords:    descriptionKeywords(movie.Description),
+	}
+	for _, genre := range movie.Genres {
+		f.genres[genre.Id] = true
+	}
+
+	return f
+}
+
+func similarity(a features, b features) float64 {
+	score := 0.0
+	for id := range a.genres {
+		if b.genres[id] {
+			score += sharedGenreWeight
+		}
+	}
+	if a.director != "" && a.director == b.director {
+		score += directorWeight
+	}
+	keywords := overlap(a.keywords, b.keywords)
+	if score == 0 && keywords == 0 {
+		// Only sharing the era is not enough to call two movies similar
+		return 0
+	}
+
+	if a.releaseYear > 0 && b.releaseYear > 0 {
+		diff := a.releaseYear - b.releaseYear
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < eraSpan {
+			score += eraWeight * float64(eraSpan-diff) / eraSpan
+		}
+	}
+
+	return score + keywordWeight*keywords
+}
+
+// overlap is the Jaccard index of the keyword sets.
+func overlap(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func descriptionKeywords(description string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	keywords := make(map[string]bool)
+	for _, word := range words {
+		runes := []rune(word)
+		if len(runes) < minKeywordLength || stopWords[word] {
+			continue
+		}
+		if len(runes) > keywordStemLength {
+			runes = runes[:keywordStemLength]
+		}
+		keywords[string(runes)] = true
+	}
+
+	return keywords
+}
+
+// rankMovies returns the movies with a positive score, the highest first.
+func rankMovies(movies []models.Movie, scores map[int]float64) []models.Movie {
+	ranked := make([]models.Movie, 0)
+	for _, movie := range movies {
+		if scores[movie.Id] > 0 {
+			ranked = append(ranked, movie)
+		}
+	}
+
+	slices.SortStableFunc(ranked, func(a, b models.Movie) int {
+		return cmp.Compare(scores[b.Id], scores[a.Id])
+	})
+
+	return ranked
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	// Paths take either an id or a slug, so a slug can't look like an id
+	numericSlugPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+var slugTransliteration = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u", 'һ': "h", 'і': "i",
+}
+
+// Slugify turns the title into a slug for urls, cyrillic letters are transliterated and everything
+// else that is not a latin letter or a digit separates the words.
+func Slugify(title string) string {
+	var slug strings.Builder
+	separate := false
+	for _, r := range strings.ToLower(title) {
+		part, ok := slugTransliteration[r]
+		if !ok {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				part = string(r)
+			} else {
+				separate = true
+				continue
+			}
+		}
+		if part == "" {
+			continue
+		}
+
+		if separate && slug.Len() > 0 {
+			slug.WriteByte('-')
+		}
+		separate = false
+		slug.WriteString(part)
+	}
+
+	return slug.String()
+}
+
+// IsValidSlug checks that the slug is lowercase latin words and digits joined by hyphens, and not only digits.
+func IsValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug) && !numericSlugPattern.MatchString(slug)
+}
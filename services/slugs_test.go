@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Брат 2", "brat-2"},
+		{"Ёлки", "elki"},
+		{"Подъезд", "podezd"},
+		{"Щенячий патруль", "shchenyachiy-patrul"},
+		{"Матрица: Перезагрузка", "matritsa-perezagruzka"},
+		{"«Сталкер»", "stalker"},
+		{"Қыз Жібек", "qyz-zhibek"},
+		{"Ағайынды", "agayyndy"},
+		{"Ozinshe — Өзіңше", "ozinshe-ozinshe"},
+		{"1917", "1917"},
+		{"!!!", ""},
+	}
+
+	for _, test := range tests {
+		if got := Slugify(test.title); got != test.want {
+			t.Errorf("Slugify(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
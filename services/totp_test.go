@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// totpTestSecret is the key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const totpTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestVerifyTotpCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		wantStep int64
+		wantOk   bool
+	}{
+		{"current step", totpTestSecret, "287082", 59, 1, true},
+		{"later test vector", totpTestSecret, "081804", 1111111109, 37037036, true},
+		{"previous step", totpTestSecret, "287082", 89, 1, true},
+		{"next step", totpTestSecret, "287082", 29, 1, true},
+		{"two steps late", totpTestSecret, "287082", 119, 0, false},
+		{"two steps early", totpTestSecret, "081804", 1111111109 - 60, 0, false},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", 59, 1, true},
+		{"wrong code", totpTestSecret, "287083", 59, 0, false},
+		{"short code", totpTestSecret, "28708", 59, 0, false},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := VerifyTotpCode(test.secret, test.code, time.Unix(test.now, 0))
+			if step != test.wantStep || ok != test.wantOk {
+				t.Errorf("VerifyTotpCode() = %d, %t, want %d, %t", step, ok, test.wantStep, test.wantOk)
+			}
+		})
+	}
+}
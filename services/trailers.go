@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"ozinshe-final-project/models"
+	"regexp"
+	"strings"
+)
+
+var ErrUnsupportedTrailer = errors.New("only YouTube, Vimeo and direct MP4 links are supported")
+
+var (
+	youtubeIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoIdPattern   = regexp.MustCompile(`^[0-9]+$`)
+	// Unlisted Vimeo videos only play with the privacy hash from their link
+	vimeoHashPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+)
+
+// ParseTrailerUrl validates the link and brings it to the canonical form of its provider,
+// dropping tracking parameters like &ab_channel=.
+func ParseTrailerUrl(raw string) (models.Trailer, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.Trailer{}, ErrUnsupportedTrailer
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+
+	switch host {
+	case "youtube.com", "m.youtube.com", "youtube-nocookie.com":
+		videoId := u.Query().Get("v")
+		if len(segments) == 2 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live" || segments[0] == "v") {
+			videoId = segments[1]
+		}
+		return youtubeTrailer(videoId)
+	case "youtu.be":
+		if len(segments) != 1 {
+			return models.Trailer{}, ErrUnsupportedTrailer
+		}
+		return youtubeTrailer(segments[0])
+	case "vimeo.com", "player.vimeo.com":
+		// vimeo.com/{id}/{hash} and player.vimeo.com/video/{id}?h={hash} are unlisted videos
+		if len(segments) == 2 && vimeoIdPattern.MatchString(segments[0]) && vimeoHashPattern.MatchString(segments[1]) {
+			return vimeoTrailer(segments[0], segments[1])
+		}
+
+		// vimeo.com/{id}, vimeo.com/channels/{channel}/{id}, player.vimeo.com/video/{id}
+		for i := len(segments) - 1; i >= 0; i-- {
+			if vimeoIdPattern.MatchString(segments[i]) {
+				hash := strings.ToLower(u.Query().Get("h"))
+				if !vimeoHashPattern.MatchString(hash) {
+					hash = ""
+				}
+				return vimeoTrailer(segments[i], hash)
+			}
+		}
+		return models.Trailer{}, ErrUnsupportedTrailer
+	}
+
+	if strings.HasSuffix(strings.ToLower(u.Path), ".mp4") {
+		u.Fragment = ""
+		return models.Trailer{Provider: models.TrailerProviderMp4, Url: u.String()}, nil
+	}
+
+	return models.Trailer{}, ErrUnsupportedTrailer
+}
+
+func youtubeTrailer(videoId string) (models.Trailer, error) {
+	if !youtubeIdPattern.MatchString(videoId) {
+		return models.Trailer{}, ErrUnsupportedTrailer
+	}
+
+	return models.Trailer{
+		Provider: models.TrailerProviderYoutube,
+		VideoId:  videoId,
+		Url:      fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoId),
+	}, nil
+}
+
+// vimeoTrailer keeps the privacy hash of unlisted videos in the url, hash is empty for public ones.
+func vimeoTrailer(videoId string, hash string) (models.Trailer, error) {
+	trailer := models.Trailer{
+		Provider: models.TrailerProviderVimeo,
+		VideoId:  videoId,
+		Url:      fmt.Sprintf("https://vimeo.com/%s", videoId),
+	}
+	if hash != "" {
+		trailer.Url += "/" + hash
+	}
+
+	return trailer, nil
+}
+
+// vimeoHash returns the privacy hash kept in the url of an unlisted video.
+func vimeoHash(trailer models.Trailer) string {
+	hash, _ := strings.CutPrefix(trailer.Url, fmt.Sprintf("https://vimeo.com/%s/", trailer.VideoId))
+	if !vimeoHashPattern.MatchString(hash) {
+		return ""
+	}
+
+	return hash
+}
+
+// TrailerEmbedUrl returns the link to use in an iframe or a video tag.
+func TrailerEmbedUrl(trailer models.Trailer) string {
+	switch trailer.Provider {
+	case models.TrailerProviderYoutube:
+		return fmt.Sprintf("https://www.youtube.com/embed/%s", trailer.VideoId)
+	case models.TrailerProviderVimeo:
+		if hash := vimeoHash(trailer); hash != "" {
+			return fmt.Sprintf("https://player.vimeo.com/video/%s?h=%s", trailer.VideoId, hash)
+		}
+		return fmt.Sprintf("https://player.vimeo.com/video/%s", trailer.VideoId)
+	case models.TrailerProviderMp4:
+		return trailer.Url
+	default:
+		return ""
+	}
+}
+
+// TrailerThumbnailUrl returns the preview image of the video. Direct files have none, and neither do Vimeo
+// videos: Vimeo has no stable image url made from the id, clients show the poster instead.
+func TrailerThumbnailUrl(trailer models.Trailer) string {
+	switch trailer.Provider {
+	case models.TrailerProviderYoutube:
+		return fmt.Sprintf("https://img.youtube.com/vi/%s/hqdefault.jpg", trailer.VideoId)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"ozinshe-final-project/models"
+	"testing"
+)
+
+func TestParseTrailerUrl(t *testing.T) {
+	youtube := models.Trailer{
+		Provider: models.TrailerProviderYoutube,
+		VideoId:  "dQw4w9WgXcQ",
+		Url:      "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+	}
+	vimeo := models.Trailer{
+		Provider: models.TrailerProviderVimeo,
+		VideoId:  "76979871",
+		Url:      "https://vimeo.com/76979871",
+	}
+	unlistedVimeo := models.Trailer{
+		Provider: models.TrailerProviderVimeo,
+		VideoId:  "76979871",
+		Url:      "https://vimeo.com/76979871/8272103f6e",
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    models.Trailer
+		wantErr error
+	}{
+		{"youtube watch", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&ab_channel=RickAstley", youtube, nil},
+		{"youtube with start time", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", youtube, nil},
+		{"youtube mobile", "https://m.youtube.com/watch?v=dQw4w9WgXcQ", youtube, nil},
+		{"youtu.be", "https://youtu.be/dQw4w9WgXcQ", youtube, nil},
+		{"youtu.be with start time", "https://youtu.be/dQw4w9WgXcQ?t=42", youtube, nil},
+		{"youtube shorts", "https://youtube.com/shorts/dQw4w9WgXcQ", youtube, nil},
+		{"youtube embed", "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", youtube, nil},
+		{"youtube live", "https://www.youtube.com/live/dQw4w9WgXcQ", youtube, nil},
+		{"youtube invalid id", "https://www.youtube.com/watch?v=short", models.Trailer{}, ErrUnsupportedTrailer},
+		{"youtube channel", "https://www.youtube.com/@RickAstleyYT", models.Trailer{}, ErrUnsupportedTrailer},
+		{"vimeo", "https://vimeo.com/76979871", vimeo, nil},
+		{"vimeo channel", "https://vimeo.com/channels/staffpicks/76979871", vimeo, nil},
+		{"vimeo player", "https://player.vimeo.com/video/76979871", vimeo, nil},
+		{"vimeo unlisted", "https://vimeo.com/76979871/8272103f6e", unlistedVimeo, nil},
+		{"vimeo player unlisted", "https://player.vimeo.com/video/76979871?h=8272103f6e", unlistedVimeo, nil},
+		{"vimeo without id", "https://vimeo.com/channels/staffpicks", models.Trailer{}, ErrUnsupportedTrailer},
+		{
+			"mp4",
+			"https://cdn.example.com/trailers/movie.mp4?token=abc#t=10",
+			models.Trailer{Provider: models.TrailerProviderMp4, Url: "https://cdn.example.com/trailers/movie.mp4?token=abc"},
+			nil,
+		},
+		{"other site", "https://example.com/trailer", models.Trailer{}, ErrUnsupportedTrailer},
+		{"not http", "ftp://example.com/movie.mp4", models.Trailer{}, ErrUnsupportedTrailer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTrailerUrl(test.raw)
+			if got != test.want || !errors.Is(err, test.wantErr) {
+				t.Errorf("ParseTrailerUrl(%q) = %+v, %v, want %+v, %v", test.raw, got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrailerEmbedUrl(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ", "https://www.youtube.com/embed/dQw4w9WgXcQ"},
+		{"https://vimeo.com/76979871", "https://player.vimeo.com/video/76979871"},
+		{"https://vimeo.com/76979871/8272103f6e", "https://player.vimeo.com/video/76979871?h=8272103f6e"},
+		{"https://cdn.example.com/movie.mp4", "https://cdn.example.com/movie.mp4"},
+	}
+
+	for _, test := range tests {
+		trailer, err := ParseTrailerUrl(test.raw)
+		if err != nil {
+			t.Fatalf("ParseTrailerUrl(%q) error = %s", test.raw, err)
+		}
+		if got := TrailerEmbedUrl(trailer); got != test.want {
+			t.Errorf("TrailerEmbedUrl(%q) = %q, want %q", test.raw, got, test.want)
+		}
+	}
+}